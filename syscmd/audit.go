@@ -0,0 +1,243 @@
+package syscmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditEntry is a single line of the audit log
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Actor        string    `json:"actor,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Argv         []string  `json:"argv"`
+	Dir          string    `json:"cwd"`
+	ExitCode     int       `json:"exit_code"`
+	DurationMs   int64     `json:"duration_ms"`
+	Attempts     int       `json:"attempts"`
+	OutputSHA256 string    `json:"output_sha256"`
+	Error        string    `json:"error,omitempty"` // ErrorSummary of the error, without output
+}
+
+// AuditOptions configures an AuditLog
+type AuditOptions struct {
+	// MaxSize rotates a file-backed log once it would grow beyond this many bytes. Zero disables rotation.
+	MaxSize int64
+
+	// MaxBackups is the number of rotated files kept as path.1 ... path.N. Defaults to 1.
+	MaxBackups int
+
+	// Sync flushes every entry to stable storage when the writer supports it.
+	Sync bool
+
+	// Redact masks secrets in argv. Defaults to RedactArgs.
+	Redact func(args []string) []string
+
+	// OnError is called when an entry recorded for an execution cannot be written.
+	OnError func(err error)
+}
+
+// AuditLog writes one JSON line per command execution. It is safe for concurrent use.
+type AuditLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	opts AuditOptions
+
+	path   string   // set for file-backed logs
+	file   *os.File // current file of a file-backed log
+	size   int64
+	closed bool
+}
+
+// NewAuditLog creates an audit log writing to w. Rotation is not available for plain writers.
+func NewAuditLog(w io.Writer, opts AuditOptions) *AuditLog {
+	if opts.Redact == nil {
+		opts.Redact = RedactArgs
+	}
+	return &AuditLog{w: w, opts: opts}
+}
+
+// OpenAuditLog creates an audit log appending to the file at path,
+// rotating it according to opts.MaxSize.
+func OpenAuditLog(path string, opts AuditOptions) (*AuditLog, error) {
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = 1
+	}
+	a := NewAuditLog(nil, opts)
+	a.path = path
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Close closes the underlying file of a file-backed log
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	a.w = io.Discard
+	a.closed = true
+	return err
+}
+
+// Write appends an entry to the log
+func (a *AuditLog) Write(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.path != "" && a.file == nil && !a.closed {
+		// a failed rotation could not reopen the file
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+
+	// a failed rotation leaves path open, the entry is still written to it
+	var rotateErr error
+	if a.file != nil && a.opts.MaxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.opts.MaxSize {
+		if rotateErr = a.rotate(); a.file == nil {
+			return rotateErr
+		}
+	}
+
+	n, err := a.w.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	if a.opts.Sync {
+		if s, ok := a.w.(interface{ Sync() error }); ok {
+			if err := s.Sync(); err != nil {
+				return fmt.Errorf("failed to sync audit log: %w", err)
+			}
+		}
+	}
+	return rotateErr
+}
+
+func (a *AuditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	a.file = f
+	a.w = f
+	a.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 to path.N, ..., path to path.1 and reopens path.
+// When path cannot be renamed it is reopened as is.
+func (a *AuditLog) rotate() error {
+	err := a.file.Close()
+	a.file = nil
+	a.w = nil
+	if err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	for i := a.opts.MaxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", a.path, i), fmt.Sprintf("%s.%d", a.path, i+1))
+	}
+	if err := os.Rename(a.path, a.path+".1"); err != nil {
+		return errors.Join(fmt.Errorf("failed to rotate audit log: %w", err), a.open())
+	}
+	return a.open()
+}
+
+func (a *AuditLog) entry(ctx context.Context, start time.Time, res *Result, err error) AuditEntry {
+	sum := sha256.Sum256([]byte(res.Output))
+	entry := AuditEntry{
+		Time:         start,
+		Actor:        ActorFromContext(ctx),
+		RequestID:    RequestIDFromContext(ctx),
+		Argv:         a.opts.Redact(append([]string{res.Name}, res.Args...)),
+		Dir:          res.Dir,
+		ExitCode:     res.ExitCode,
+		DurationMs:   res.Duration.Milliseconds(),
+		Attempts:     res.Attempts,
+		OutputSHA256: hex.EncodeToString(sum[:]),
+	}
+	if entry.Dir == "" {
+		entry.Dir, _ = os.Getwd()
+	}
+	if err != nil {
+		entry.Error = ErrorSummary(err)
+	}
+	return entry
+}
+
+var globalAuditLog atomic.Pointer[AuditLog]
+
+// SetAuditLog installs an audit log recording every Process execution. Passing nil removes it.
+func SetAuditLog(a *AuditLog) {
+	globalAuditLog.Store(a)
+}
+
+// audit records the execution to the global and the process audit logs.
+// Audit failures are not returned to the caller, the command already ran.
+func (c *Process) audit(start time.Time, res *Result, err error) {
+	for _, a := range []*AuditLog{globalAuditLog.Load(), c.auditLog} {
+		if a == nil {
+			continue
+		}
+		if werr := a.Write(a.entry(c.ctx, start, res, err)); werr != nil && a.opts.OnError != nil {
+			a.opts.OnError(werr)
+		}
+	}
+}
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+)
+
+// WithActor attaches the identity on whose behalf commands are run to ctx
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// WithRequestID attaches a request ID to ctx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID set with WithRequestID
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -0,0 +1,143 @@
+package syscmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAuditEntries(t *testing.T, data []byte) []AuditEntry {
+	t.Helper()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAudit_RecordsExecution(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewAuditLog(&buf, AuditOptions{})
+
+	ctx := WithRequestID(WithActor(context.Background(), "alice"), "req-1")
+	dir := t.TempDir()
+	output, err := New(ctx).Dir(dir).Audit(log).Execute("echo", "--token", "s3cr3t", "hello")
+	require.NoError(t, err)
+
+	entries := readAuditEntries(t, buf.Bytes())
+	require.Len(t, entries, 1)
+	entry := entries[0]
+
+	sum := sha256.Sum256([]byte(output))
+	assert.Equal(t, "alice", entry.Actor)
+	assert.Equal(t, "req-1", entry.RequestID)
+	assert.Equal(t, []string{"echo", "--token", Redacted, "hello"}, entry.Argv)
+	assert.Equal(t, dir, entry.Dir)
+	assert.Equal(t, 0, entry.ExitCode)
+	assert.Equal(t, 1, entry.Attempts)
+	assert.Equal(t, hex.EncodeToString(sum[:]), entry.OutputSHA256)
+	assert.Empty(t, entry.Error)
+	assert.WithinDuration(t, time.Now(), entry.Time, 5*time.Second)
+}
+
+func TestAudit_RecordsFailure(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewAuditLog(&buf, AuditOptions{})
+
+	_, err := New(context.Background()).
+		Retry(1, 10*time.Millisecond).
+		Audit(log).
+		Env("OUT=SECRET_OUTPUT").
+		Execute("sh", "-c", "echo $OUT; exit 3")
+	require.Error(t, err)
+
+	entries := readAuditEntries(t, buf.Bytes())
+	require.Len(t, entries, 1)
+	assert.Equal(t, 3, entries[0].ExitCode)
+	assert.Equal(t, 2, entries[0].Attempts)
+	assert.Equal(t, "command failed: exit status 3", entries[0].Error)
+	assert.NotContains(t, buf.String(), "SECRET_OUTPUT")
+	cwd, _ := os.Getwd()
+	assert.Equal(t, cwd, entries[0].Dir)
+}
+
+func TestAudit_GlobalLog(t *testing.T) {
+	var buf bytes.Buffer
+	SetAuditLog(NewAuditLog(&buf, AuditOptions{}))
+	defer SetAuditLog(nil)
+
+	_, err := Run(context.Background(), "true")
+	require.NoError(t, err)
+	assert.Len(t, readAuditEntries(t, buf.Bytes()), 1)
+}
+
+func TestAudit_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := OpenAuditLog(path, AuditOptions{MaxSize: 300, MaxBackups: 2, Sync: true})
+	require.NoError(t, err)
+	defer log.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, log.Write(AuditEntry{Argv: []string{"echo", strings.Repeat("x", 100)}}))
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(300))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAudit_RotationFailureKeepsWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := OpenAuditLog(path, AuditOptions{MaxSize: 100})
+	require.NoError(t, err)
+	defer log.Close()
+
+	// a directory in the way of the rotated file makes the rename fail
+	require.NoError(t, os.Mkdir(path+".1", 0o700))
+	entry := AuditEntry{Argv: []string{"echo", strings.Repeat("x", 50)}}
+	require.NoError(t, log.Write(entry))
+	assert.ErrorContains(t, log.Write(entry), "failed to rotate audit log")
+	assert.ErrorContains(t, log.Write(entry), "failed to rotate audit log")
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, readAuditEntries(t, data), 3, "entries are kept in the unrotated file")
+
+	require.NoError(t, os.Remove(path+".1"))
+	require.NoError(t, log.Write(entry))
+	data, err = os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Len(t, readAuditEntries(t, data), 3)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestAudit_OnError(t *testing.T) {
+	var reported error
+	log := NewAuditLog(failingWriter{}, AuditOptions{OnError: func(err error) { reported = err }})
+
+	_, err := New(context.Background()).Audit(log).Execute("true")
+	require.NoError(t, err)
+	assert.ErrorContains(t, reported, "disk full")
+}
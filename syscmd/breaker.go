@@ -0,0 +1,236 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit
+type BreakerState int
+
+const (
+	StateClosed   BreakerState = iota // calls pass through
+	StateOpen                         // calls fail fast with ErrCircuitOpen
+	StateHalfOpen                     // a single probe call is let through
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// Breaker wraps a Command with a circuit breaker per key. After Threshold
+// consecutive failures the circuit opens and calls fail with ErrCircuitOpen
+// until the cool-down has passed. A single probe call then decides whether
+// the circuit closes again. By default the key is the base name of the binary.
+type Breaker struct {
+	cmd       Command
+	threshold int
+	cooldown  time.Duration
+	keyFn     func(name string, args []string) string
+	isFailure func(err error) bool
+	onChange  func(key string, from, to BreakerState)
+	now       func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state      BreakerState
+	failures   int
+	openedAt   time.Time
+	probing    bool
+	generation uint64 // changes on every transition, reports of calls admitted before are ignored
+}
+
+// outcome classifies the result of a call
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	outcomeIgnored // says nothing about the health of the command
+)
+
+// Ensure Breaker implements Command at compile time
+var _ Command = (*Breaker)(nil)
+
+// NewBreaker wraps cmd with a circuit breaker opening after 5 consecutive
+// failures for 30 seconds
+func NewBreaker(cmd Command) *Breaker {
+	return &Breaker{
+		cmd:       cmd,
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		keyFn: func(name string, _ []string) string {
+			return filepath.Base(name)
+		},
+		isFailure: defaultIsFailure,
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// Threshold sets the number of consecutive failures opening the circuit
+func (b *Breaker) Threshold(failures int) *Breaker {
+	b.threshold = failures
+	return b
+}
+
+// Cooldown sets how long the circuit stays open before a probe call is allowed
+func (b *Breaker) Cooldown(d time.Duration) *Breaker {
+	b.cooldown = d
+	return b
+}
+
+// Key sets the function mapping a command to its circuit
+func (b *Breaker) Key(fn func(name string, args []string) string) *Breaker {
+	b.keyFn = fn
+	return b
+}
+
+// IsFailure sets the function deciding whether an error counts as a failure
+// of the command. Errors it rejects neither open nor close the circuit. By
+// default caller cancellation, policy denials and missing executables are not
+// failures.
+func (b *Breaker) IsFailure(fn func(err error) bool) *Breaker {
+	b.isFailure = fn
+	return b
+}
+
+func defaultIsFailure(err error) bool {
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, ErrPolicyDenied) &&
+		!errors.Is(err, exec.ErrNotFound)
+}
+
+// OnStateChange sets a callback invoked on every state transition.
+// It is called without holding the breaker's lock.
+func (b *Breaker) OnStateChange(fn func(key string, from, to BreakerState)) *Breaker {
+	b.onChange = fn
+	return b
+}
+
+// State returns the current state of the circuit for key
+func (b *Breaker) State(key string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[key]; ok {
+		return c.state
+	}
+	return StateClosed
+}
+
+// Execute runs the command unless its circuit is open
+func (b *Breaker) Execute(name string, args ...string) (string, error) {
+	key := b.keyFn(name, args)
+	generation, probe, err := b.allow(key)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := b.cmd.Execute(name, args...)
+	result := outcomeSuccess
+	if err != nil {
+		result = outcomeFailure
+		if !b.isFailure(err) {
+			result = outcomeIgnored
+		}
+	}
+	b.report(key, generation, probe, result)
+	return output, err
+}
+
+// allow checks whether a call may pass, moving an expired open circuit to
+// half-open. It returns the generation the call is admitted under and
+// whether it is the probe of a half-open circuit.
+func (b *Breaker) allow(key string) (uint64, bool, error) {
+	b.mu.Lock()
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{}
+		b.circuits[key] = c
+	}
+
+	from := c.state
+	switch c.state {
+	case StateOpen:
+		if b.now().Sub(c.openedAt) < b.cooldown {
+			b.mu.Unlock()
+			return 0, false, fmt.Errorf("%w for %q", ErrCircuitOpen, key)
+		}
+		c.transition(StateHalfOpen)
+		c.probing = true
+	case StateHalfOpen:
+		if c.probing {
+			b.mu.Unlock()
+			return 0, false, fmt.Errorf("%w for %q", ErrCircuitOpen, key)
+		}
+		c.probing = true
+	}
+	to := c.state
+	generation, probe := c.generation, c.state == StateHalfOpen
+	b.mu.Unlock()
+
+	b.notify(key, from, to)
+	return generation, probe, nil
+}
+
+// report records the outcome of a call admitted under generation. Calls
+// admitted before the last state transition are ignored.
+func (b *Breaker) report(key string, generation uint64, probe bool, result outcome) {
+	b.mu.Lock()
+	c := b.circuits[key]
+	if c.generation != generation {
+		b.mu.Unlock()
+		return
+	}
+	from := c.state
+	if probe {
+		c.probing = false
+	}
+	switch result {
+	case outcomeSuccess:
+		c.failures = 0
+		if c.state != StateClosed {
+			c.transition(StateClosed)
+		}
+	case outcomeFailure:
+		c.failures++
+		if c.state == StateHalfOpen || c.failures >= b.threshold {
+			c.transition(StateOpen)
+			c.openedAt = b.now()
+		}
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.notify(key, from, to)
+}
+
+// transition moves the circuit to state, starting a new generation
+func (c *circuit) transition(state BreakerState) {
+	c.state = state
+	c.generation++
+}
+
+func (b *Breaker) notify(key string, from, to BreakerState) {
+	if from != to && b.onChange != nil {
+		b.onChange(key, from, to)
+	}
+}
@@ -0,0 +1,201 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker_OpensAfterThreshold(t *testing.T) {
+	stub := &countingCommand{err: errors.New("api down")}
+	breaker := NewBreaker(stub).Threshold(3).Cooldown(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err := breaker.Execute("vendor-cli", "sync")
+		assert.EqualError(t, err, "api down")
+	}
+	assert.Equal(t, StateOpen, breaker.State("vendor-cli"))
+
+	_, err := breaker.Execute("vendor-cli", "sync")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), stub.calls.Load(), "open circuit must not call the command")
+
+	// other binaries have their own circuit
+	_, err = breaker.Execute("other-cli")
+	assert.EqualError(t, err, "api down")
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	stub := &countingCommand{err: errors.New("flaky")}
+	breaker := NewBreaker(stub).Threshold(2)
+
+	breaker.Execute("tool")
+	stub.err = nil
+	breaker.Execute("tool")
+	stub.err = errors.New("flaky")
+	breaker.Execute("tool")
+
+	assert.Equal(t, StateClosed, breaker.State("tool"))
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	stub := &countingCommand{err: errors.New("down")}
+	now := time.Now()
+
+	var mu sync.Mutex
+	var transitions []string
+	breaker := NewBreaker(stub).
+		Threshold(1).
+		Cooldown(10 * time.Second).
+		OnStateChange(func(key string, from, to BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, key+":"+from.String()+"->"+to.String())
+		})
+	breaker.now = func() time.Time { return now }
+
+	breaker.Execute("tool")
+	assert.Equal(t, StateOpen, breaker.State("tool"))
+
+	// the probe fails, the circuit opens again
+	now = now.Add(11 * time.Second)
+	_, err := breaker.Execute("tool")
+	assert.EqualError(t, err, "down")
+	assert.Equal(t, StateOpen, breaker.State("tool"))
+
+	// the probe succeeds, the circuit closes
+	now = now.Add(11 * time.Second)
+	stub.err = nil
+	_, err = breaker.Execute("tool")
+	require.NoError(t, err)
+	assert.Equal(t, StateClosed, breaker.State("tool"))
+
+	assert.Equal(t, []string{
+		"tool:closed->open",
+		"tool:open->half-open",
+		"tool:half-open->open",
+		"tool:open->half-open",
+		"tool:half-open->closed",
+	}, transitions)
+}
+
+func TestBreaker_SingleProbe(t *testing.T) {
+	stub := &countingCommand{err: errors.New("down")}
+	breaker := NewBreaker(stub).Threshold(1).Cooldown(10 * time.Millisecond)
+	breaker.Execute("tool")
+	time.Sleep(20 * time.Millisecond)
+
+	stub.err = nil
+	stub.delay = 100 * time.Millisecond
+	stub.calls.Store(0)
+
+	var wg sync.WaitGroup
+	var rejected atomic.Int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := breaker.Execute("tool"); errors.Is(err, ErrCircuitOpen) {
+				rejected.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), stub.calls.Load())
+	assert.Equal(t, int32(4), rejected.Load())
+	assert.Equal(t, StateClosed, breaker.State("tool"))
+}
+
+func TestBreaker_CustomKeyWithProcess(t *testing.T) {
+	breaker := NewBreaker(New(context.Background())).
+		Threshold(1).
+		Key(func(string, []string) string { return "shared" })
+
+	_, err := breaker.Execute("false")
+	require.Error(t, err)
+
+	_, err = breaker.Execute("true")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Contains(t, err.Error(), `"shared"`)
+}
+
+func TestBreaker_IgnoresNonFailures(t *testing.T) {
+	stub := &countingCommand{err: fmt.Errorf("command failed: %w", context.Canceled)}
+	breaker := NewBreaker(stub).Threshold(1)
+
+	breaker.Execute("tool")
+	stub.err = &PolicyError{Command: "tool", Reason: "denied"}
+	breaker.Execute("tool")
+	assert.Equal(t, StateClosed, breaker.State("tool"))
+
+	// a custom classification
+	breaker.IsFailure(func(err error) bool { return true })
+	breaker.Execute("tool")
+	assert.Equal(t, StateOpen, breaker.State("tool"))
+}
+
+// funcCommand is a Command stub backed by a function
+type funcCommand func(name string, args ...string) (string, error)
+
+func (f funcCommand) Execute(name string, args ...string) (string, error) {
+	return f(name, args...)
+}
+
+func TestBreaker_IgnoresStaleReports(t *testing.T) {
+	slowStarted, slowRelease, probeRelease := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	cmd := funcCommand(func(name string, args ...string) (string, error) {
+		switch name {
+		case "slow":
+			close(slowStarted)
+			<-slowRelease
+			return "", nil
+		case "probe":
+			<-probeRelease
+			return "", errors.New("still down")
+		}
+		return "", errors.New("down")
+	})
+	breaker := NewBreaker(cmd).
+		Threshold(1).
+		Cooldown(10 * time.Second).
+		Key(func(string, []string) string { return "tool" })
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	// a slow call admitted while closed outlives the circuit opening
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		breaker.Execute("slow")
+	}()
+	<-slowStarted
+	breaker.Execute("fail")
+	require.Equal(t, StateOpen, breaker.State("tool"))
+
+	now = now.Add(11 * time.Second)
+	probeDone := make(chan struct{})
+	go func() {
+		defer close(probeDone)
+		breaker.Execute("probe")
+	}()
+	require.Eventually(t, func() bool { return breaker.State("tool") == StateHalfOpen }, time.Second, time.Millisecond)
+
+	// its success neither closes the circuit nor ends the probe
+	close(slowRelease)
+	<-slowDone
+	assert.Equal(t, StateHalfOpen, breaker.State("tool"))
+	_, err := breaker.Execute("other")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	close(probeRelease)
+	<-probeDone
+	assert.Equal(t, StateOpen, breaker.State("tool"))
+}
@@ -0,0 +1,175 @@
+package syscmd
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache wraps a Command and memoizes its output for a fixed time. Concurrent
+// identical calls share a single execution. Only successful executions are
+// cached unless CacheErrors is set. It is safe for concurrent use.
+type Cache struct {
+	cmd         Command
+	ttl         time.Duration
+	maxEntries  int
+	cacheErrors bool
+	now         func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element // values are *cacheEntry
+	lru      *list.List
+	inflight map[string]*cacheCall
+}
+
+type cacheEntry struct {
+	key     string
+	output  string
+	err     error
+	expires time.Time
+}
+
+type cacheCall struct {
+	done   chan struct{}
+	output string
+	err    error
+}
+
+// Ensure Cache implements Command at compile time
+var _ Command = (*Cache)(nil)
+
+// Cached wraps cmd so that its results are reused for ttl. Results are keyed
+// on the command name and arguments, and on the environment and working
+// directory when cmd is a *Process.
+func Cached(cmd Command, ttl time.Duration) *Cache {
+	return &Cache{
+		cmd:      cmd,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*cacheCall),
+	}
+}
+
+// MaxEntries limits the number of cached results, evicting the least recently used. Zero means no limit.
+func (c *Cache) MaxEntries(n int) *Cache {
+	c.maxEntries = n
+	return c
+}
+
+// CacheErrors makes failed executions cached as well
+func (c *Cache) CacheErrors() *Cache {
+	c.cacheErrors = true
+	return c
+}
+
+// Execute returns the cached result of the command or runs it
+func (c *Cache) Execute(name string, args ...string) (string, error) {
+	key := c.key(name, args)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			return entry.output, entry.err
+		}
+		c.remove(elem)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.output, call.err
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	defer func() {
+		// release the waiting callers when the command panics
+		if r := recover(); r != nil {
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+			call.err = fmt.Errorf("syscmd: cached command panicked: %v", r)
+			close(call.done)
+			panic(r)
+		}
+	}()
+	call.output, call.err = c.cmd.Execute(name, args...)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if call.err == nil || c.cacheErrors {
+		c.store(&cacheEntry{key: key, output: call.output, err: call.err, expires: c.now().Add(c.ttl)})
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.output, call.err
+}
+
+// Invalidate drops the cached result of a command. It only affects results
+// of this Cache, so it matches the environment and directory of the wrapped command.
+func (c *Cache) Invalidate(name string, args ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[c.key(name, args)]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge drops all cached results
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Len returns the number of cached results, including expired ones not yet evicted
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) store(entry *cacheEntry) {
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// key joins argv, environment and directory with separators that cannot appear in arguments
+func (c *Cache) key(name string, args []string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, arg := range args {
+		b.WriteByte(0)
+		b.WriteString(arg)
+	}
+	if p, ok := c.cmd.(*Process); ok {
+		b.WriteString("\x00\x01")
+		b.WriteString(strings.Join(p.env, "\x00"))
+		b.WriteString("\x00\x01")
+		b.WriteString(strings.Join(p.envFiles, "\x00"))
+		b.WriteString("\x00\x01")
+		b.WriteString(p.dir)
+	}
+	return b.String()
+}
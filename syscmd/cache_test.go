@@ -0,0 +1,178 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCommand is a Command stub that counts executions
+type countingCommand struct {
+	calls atomic.Int32
+	delay time.Duration
+	err   error
+}
+
+func (c *countingCommand) Execute(name string, args ...string) (string, error) {
+	n := c.calls.Add(1)
+	time.Sleep(c.delay)
+	if c.err != nil {
+		return "", c.err
+	}
+	return strings.Join(append([]string{name}, args...), " ") + "#" + strconv.Itoa(int(n)), nil
+}
+
+func TestCache_ReusesResult(t *testing.T) {
+	stub := &countingCommand{}
+	cache := Cached(stub, time.Minute)
+
+	first, err := cache.Execute("uname", "-r")
+	require.NoError(t, err)
+	second, err := cache.Execute("uname", "-r")
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, int32(1), stub.calls.Load())
+
+	_, err = cache.Execute("uname", "-a")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), stub.calls.Load())
+}
+
+func TestCache_Expiry(t *testing.T) {
+	stub := &countingCommand{}
+	cache := Cached(stub, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Execute("date")
+	now = now.Add(59 * time.Second)
+	cache.Execute("date")
+	assert.Equal(t, int32(1), stub.calls.Load())
+
+	now = now.Add(2 * time.Second)
+	cache.Execute("date")
+	assert.Equal(t, int32(2), stub.calls.Load())
+}
+
+func TestCache_Singleflight(t *testing.T) {
+	stub := &countingCommand{delay: 100 * time.Millisecond}
+	cache := Cached(stub, time.Minute)
+
+	var wg sync.WaitGroup
+	outputs := make([]string, 10)
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outputs[i], _ = cache.Execute("kubectl", "version")
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), stub.calls.Load())
+	for _, output := range outputs {
+		assert.Equal(t, outputs[0], output)
+	}
+}
+
+func TestCache_PanicReleasesWaiters(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	cache := Cached(funcCommand(func(name string, args ...string) (string, error) {
+		once.Do(func() { close(started) })
+		<-release
+		panic("boom")
+	}), time.Minute)
+
+	go func() {
+		defer func() { recover() }()
+		cache.Execute("kubectl", "version")
+	}()
+	<-started
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := cache.Execute("kubectl", "version")
+		errc <- err
+	}()
+	// let the second caller wait for the first
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-errc:
+		assert.ErrorContains(t, err, "cached command panicked: boom")
+	case <-time.After(time.Second):
+		t.Fatal("the waiting caller was not released")
+	}
+	assert.Panics(t, func() { cache.Execute("kubectl", "version") }, "the panic is not cached")
+}
+
+func TestCache_Errors(t *testing.T) {
+	stub := &countingCommand{err: errors.New("boom")}
+
+	cache := Cached(stub, time.Minute)
+	cache.Execute("false")
+	cache.Execute("false")
+	assert.Equal(t, int32(2), stub.calls.Load(), "errors are not cached by default")
+
+	stub.calls.Store(0)
+	cache = Cached(stub, time.Minute).CacheErrors()
+	_, err := cache.Execute("false")
+	assert.EqualError(t, err, "boom")
+	_, err = cache.Execute("false")
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, int32(1), stub.calls.Load())
+}
+
+func TestCache_InvalidateAndPurge(t *testing.T) {
+	stub := &countingCommand{}
+	cache := Cached(stub, time.Minute)
+
+	cache.Execute("git", "rev-parse", "HEAD")
+	cache.Invalidate("git", "rev-parse", "HEAD")
+	cache.Execute("git", "rev-parse", "HEAD")
+	assert.Equal(t, int32(2), stub.calls.Load())
+
+	cache.Purge()
+	assert.Equal(t, 0, cache.Len())
+	cache.Execute("git", "rev-parse", "HEAD")
+	assert.Equal(t, int32(3), stub.calls.Load())
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	stub := &countingCommand{}
+	cache := Cached(stub, time.Minute).MaxEntries(2)
+
+	cache.Execute("a")
+	cache.Execute("b")
+	cache.Execute("a") // a is now most recently used
+	cache.Execute("c") // evicts b
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Execute("a")
+	assert.Equal(t, int32(3), stub.calls.Load())
+	cache.Execute("b")
+	assert.Equal(t, int32(4), stub.calls.Load())
+}
+
+func TestCache_KeysOnEnvAndDir(t *testing.T) {
+	a := Cached(New(context.Background()).Env("X=1"), time.Minute)
+	b := Cached(New(context.Background()).Env("X=2"), time.Minute)
+	assert.NotEqual(t, a.key("env", nil), b.key("env", nil))
+
+	c := Cached(New(context.Background()).Dir("/tmp"), time.Minute)
+	assert.NotEqual(t, a.key("pwd", nil), c.key("pwd", nil))
+
+	// arguments are not ambiguous when joined
+	assert.NotEqual(t, a.key("echo", []string{"a b"}), a.key("echo", []string{"a", "b"}))
+}
@@ -0,0 +1,327 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Catalog holds named command definitions loaded from configuration.
+// Arguments are rendered from typed parameters with text/template, one
+// argument per template, and never pass through a shell.
+//
+//	commands:
+//	  restart-service:
+//	    binary: systemctl
+//	    args: ["restart", "{{.unit}}.service", "{{if .now}}--no-block{{end}}"]
+//	    timeout: 30s
+//	    retries: 2
+//	    params:
+//	      unit: {type: string, required: true, pattern: "[a-z0-9@-]+"}
+//	      now: {type: bool}
+type Catalog struct {
+	Commands map[string]*CommandDef `json:"commands" yaml:"commands"`
+}
+
+// CommandDef defines a catalog command. Arguments made of a single {{if}}
+// action are dropped when they render to an empty string, so optional flags
+// can be written as {{if .x}}--x{{end}}; other arguments are always passed,
+// even when empty.
+type CommandDef struct {
+	Binary     string              `json:"binary" yaml:"binary"`
+	Args       []string            `json:"args,omitempty" yaml:"args,omitempty"`
+	Timeout    time.Duration       `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries    int                 `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryDelay time.Duration       `json:"retry_delay,omitempty" yaml:"retry_delay,omitempty"`
+	Env        []string            `json:"env,omitempty" yaml:"env,omitempty"`
+	Dir        string              `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Params     map[string]ParamDef `json:"params,omitempty" yaml:"params,omitempty"`
+
+	once      sync.Once
+	params    map[string]ParamDef // Params with types and patterns resolved
+	templates []*template.Template
+	optional  []bool // the argument is dropped when empty
+	err       error
+}
+
+// ParamDef declares a parameter of a catalog command
+type ParamDef struct {
+	// Type is one of string (default), int or bool
+	Type     string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Required bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	Default  any      `json:"default,omitempty" yaml:"default,omitempty"`
+	Pattern  string   `json:"pattern,omitempty" yaml:"pattern,omitempty"` // regular expression a string must fully match
+	Values   []string `json:"values,omitempty" yaml:"values,omitempty"`   // allowed string values
+
+	// AllowDash accepts string values starting with "-" when neither Pattern
+	// nor Values constrain them. Such values are rejected by default, as the
+	// command would read them as options.
+	AllowDash bool `json:"allow_dash,omitempty" yaml:"allow_dash,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// LoadCatalog reads command definitions from a YAML or JSON file
+func LoadCatalog(file string) (*Catalog, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	return ParseCatalog(data)
+}
+
+// ParseCatalog decodes YAML or JSON command definitions and validates them
+func ParseCatalog(data []byte) (*Catalog, error) {
+	c := &Catalog{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate compiles the argument templates and parameter patterns and checks
+// that templates only reference declared parameters
+func (c *Catalog) Validate() error {
+	for _, name := range c.Names() {
+		if err := c.validate(name, c.Commands[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) validate(name string, def *CommandDef) error {
+	if def == nil {
+		return fmt.Errorf("invalid catalog: command %q: no definition", name)
+	}
+	if err := def.Validate(); err != nil {
+		return fmt.Errorf("invalid catalog: command %q: %w", name, err)
+	}
+	return nil
+}
+
+// Names returns the sorted names of the defined commands
+func (c *Catalog) Names() []string {
+	names := make([]string, 0, len(c.Commands))
+	for name := range c.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Prepare validates params and returns the configured Process together with
+// the rendered argv, binary first
+func (c *Catalog) Prepare(ctx context.Context, name string, params map[string]any) (*Process, []string, error) {
+	def, ok := c.Commands[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown catalog command %q", name)
+	}
+	if err := c.validate(name, def); err != nil {
+		return nil, nil, err
+	}
+
+	values, err := def.bind(params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("catalog command %q: %w", name, err)
+	}
+	args, err := def.render(values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("catalog command %q: %w", name, err)
+	}
+
+	proc := New(ctx).Env(def.Env...).Dir(def.Dir)
+	if def.Timeout > 0 {
+		proc = proc.Timeout(def.Timeout)
+	}
+	if def.Retries > 0 {
+		delay := def.RetryDelay
+		if delay == 0 {
+			delay = proc.retryDelay
+		}
+		proc = proc.Retry(def.Retries, delay)
+	}
+
+	return proc, append([]string{def.Binary}, args...), nil
+}
+
+// Run renders and executes a catalog command
+func (c *Catalog) Run(ctx context.Context, name string, params map[string]any) (*Result, error) {
+	proc, argv, err := c.Prepare(ctx, name, params)
+	if err != nil {
+		return &Result{Name: name, ExitCode: -1}, err
+	}
+	return proc.ExecuteResult(argv[0], argv[1:]...)
+}
+
+// Validate compiles the definition once and reports whether it is valid.
+// The definition must not be modified afterwards.
+func (d *CommandDef) Validate() error {
+	d.once.Do(func() { d.err = d.compile() })
+	return d.err
+}
+
+func (d *CommandDef) compile() error {
+	if d.Binary == "" {
+		return fmt.Errorf("no binary")
+	}
+
+	params := make(map[string]ParamDef, len(d.Params))
+	zero := make(map[string]any, len(d.Params))
+	for pname, p := range d.Params {
+		switch p.Type {
+		case "", "string":
+			p.Type = "string"
+			zero[pname] = ""
+		case "int":
+			zero[pname] = 0
+		case "bool":
+			zero[pname] = false
+		default:
+			return fmt.Errorf("parameter %q: unknown type %q", pname, p.Type)
+		}
+		if p.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("parameter %q: %w", pname, err)
+			}
+			p.pattern = re
+		}
+		if p.Default != nil {
+			if _, err := p.convert(p.Default); err != nil {
+				return fmt.Errorf("parameter %q: default: %w", pname, err)
+			}
+		}
+		params[pname] = p
+	}
+
+	templates := make([]*template.Template, len(d.Args))
+	optional := make([]bool, len(d.Args))
+	for i, arg := range d.Args {
+		tmpl, err := template.New(fmt.Sprintf("arg%d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return err
+		}
+		templates[i] = tmpl
+		nodes := tmpl.Tree.Root.Nodes
+		if len(nodes) == 1 {
+			_, optional[i] = nodes[0].(*parse.IfNode)
+		}
+	}
+	d.params, d.templates, d.optional = params, templates, optional
+
+	// a trial render catches references to undeclared parameters
+	if _, err := d.render(zero); err != nil {
+		return err
+	}
+	return nil
+}
+
+// bind checks params against the declarations and fills in defaults
+func (d *CommandDef) bind(params map[string]any) (map[string]any, error) {
+	for pname := range params {
+		if _, ok := d.params[pname]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q", pname)
+		}
+	}
+
+	values := make(map[string]any, len(d.params))
+	for pname, p := range d.params {
+		v, ok := params[pname]
+		if !ok {
+			if p.Required {
+				return nil, fmt.Errorf("missing required parameter %q", pname)
+			}
+			v = p.Default
+		}
+		converted, err := p.convert(v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", pname, err)
+		}
+		if p.Required && converted == "" {
+			return nil, fmt.Errorf("required parameter %q is empty", pname)
+		}
+		values[pname] = converted
+	}
+	return values, nil
+}
+
+// convert checks a value against the declared type and constraints.
+// A nil value yields the zero value of the type.
+func (p ParamDef) convert(v any) (any, error) {
+	switch p.Type {
+	case "int":
+		if v == nil {
+			return 0, nil
+		}
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return int64(rv.Uint()), nil
+		}
+		return nil, fmt.Errorf("expected int, got %T", v)
+
+	case "bool":
+		if v == nil {
+			return false, nil
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected bool, got %T", v)
+		}
+		return b, nil
+
+	default:
+		if v == nil {
+			return "", nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %T", v)
+		}
+		if p.pattern != nil && !p.pattern.MatchString(s) {
+			return nil, fmt.Errorf("value %q does not match %q", s, p.Pattern)
+		}
+		if len(p.Values) > 0 && !slices.Contains(p.Values, s) {
+			return nil, fmt.Errorf("value %q is not one of %s", s, strings.Join(p.Values, ", "))
+		}
+		if p.pattern == nil && len(p.Values) == 0 && !p.AllowDash && strings.HasPrefix(s, "-") {
+			return nil, fmt.Errorf("value %q starts with a dash, set allow_dash to pass it", s)
+		}
+		return s, nil
+	}
+}
+
+func (d *CommandDef) render(values map[string]any) ([]string, error) {
+	args := make([]string, 0, len(d.templates))
+	var b strings.Builder
+	for i, tmpl := range d.templates {
+		b.Reset()
+		if err := tmpl.Execute(&b, values); err != nil {
+			return nil, err
+		}
+		if b.Len() > 0 || !d.optional[i] {
+			args = append(args, b.String())
+		}
+	}
+	return args, nil
+}
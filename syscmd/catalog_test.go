@@ -0,0 +1,227 @@
+package syscmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCatalog = `
+commands:
+  greet:
+    binary: echo
+    args: ["hello", "{{.name}}", "{{if .loud}}!!!{{end}}"]
+    timeout: 5s
+    retries: 2
+    retry_delay: 100ms
+    env: ["LANG=C"]
+    params:
+      name: {type: string, required: true, pattern: "[A-Za-z ]+"}
+      loud: {type: bool}
+  repeat:
+    binary: seq
+    args: ["{{.count}}"]
+    params:
+      count: {type: int, default: 3}
+  mode:
+    binary: echo
+    args: ["{{.mode}}"]
+    params:
+      mode: {values: [fast, safe], default: safe}
+`
+
+func TestCatalog_Run(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(testCatalog))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"greet", "mode", "repeat"}, catalog.Names())
+
+	res, err := catalog.Run(context.Background(), "greet", map[string]any{"name": "Jane Doe"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello Jane Doe\n", res.Output)
+
+	res, err = catalog.Run(context.Background(), "greet", map[string]any{"name": "Jane", "loud": true})
+	require.NoError(t, err)
+	assert.Equal(t, "hello Jane !!!\n", res.Output)
+
+	res, err = catalog.Run(context.Background(), "repeat", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n", res.Output)
+
+	res, err = catalog.Run(context.Background(), "mode", map[string]any{"mode": "fast"})
+	require.NoError(t, err)
+	assert.Equal(t, "fast\n", res.Output)
+}
+
+func TestCatalog_Prepare(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(testCatalog))
+	require.NoError(t, err)
+
+	proc, argv, err := catalog.Prepare(context.Background(), "greet", map[string]any{"name": "Bob"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "hello", "Bob"}, argv)
+	assert.Equal(t, 5*time.Second, proc.timeout)
+	assert.Equal(t, 2, proc.retries)
+	assert.Equal(t, 100*time.Millisecond, proc.retryDelay)
+	assert.Equal(t, []string{"LANG=C"}, proc.env)
+}
+
+func TestCatalog_NoShellInjection(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(`
+commands:
+  show:
+    binary: echo
+    args: ["{{.value}}"]
+    params:
+      value: {}
+`))
+	require.NoError(t, err)
+
+	hostile := "x; touch pwned $(id) `id`"
+	res, err := catalog.Run(context.Background(), "show", map[string]any{"value": hostile})
+	require.NoError(t, err)
+	assert.Equal(t, hostile+"\n", res.Output)
+}
+
+func TestCatalog_ParamValidation(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(testCatalog))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = catalog.Run(ctx, "greet", nil)
+	assert.ErrorContains(t, err, `missing required parameter "name"`)
+
+	_, err = catalog.Run(ctx, "greet", map[string]any{"name": "Bob; rm -rf /"})
+	assert.ErrorContains(t, err, "does not match")
+
+	_, err = catalog.Run(ctx, "greet", map[string]any{"name": "Bob", "extra": 1})
+	assert.ErrorContains(t, err, `unknown parameter "extra"`)
+
+	_, err = catalog.Run(ctx, "repeat", map[string]any{"count": "3"})
+	assert.ErrorContains(t, err, "expected int")
+
+	_, err = catalog.Run(ctx, "greet", map[string]any{"name": "Bob", "loud": "yes"})
+	assert.ErrorContains(t, err, "expected bool")
+
+	_, err = catalog.Run(ctx, "mode", map[string]any{"mode": "reckless"})
+	assert.ErrorContains(t, err, "is not one of fast, safe")
+
+	_, err = catalog.Run(ctx, "missing", nil)
+	assert.ErrorContains(t, err, `unknown catalog command "missing"`)
+}
+
+func TestCatalog_EmptyValuesKeepPositions(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(`
+commands:
+  copy:
+    binary: echo
+    args: ["{{if .verbose}}-v{{end}}", "{{.label}}", "{{.src}}", "{{.dst}}"]
+    params:
+      verbose: {type: bool}
+      label: {}
+      src: {required: true}
+      dst: {required: true}
+`))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, argv, err := catalog.Prepare(ctx, "copy", map[string]any{"label": "", "src": "a", "dst": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "", "a", "b"}, argv, "only the conditional argument is dropped")
+
+	_, err = catalog.Run(ctx, "copy", map[string]any{"src": "", "dst": "b"})
+	assert.ErrorContains(t, err, `required parameter "src" is empty`)
+}
+
+func TestCatalog_RejectsLeadingDash(t *testing.T) {
+	catalog, err := ParseCatalog([]byte(`
+commands:
+  show:
+    binary: echo
+    args: ["{{.value}}"]
+    params:
+      value: {}
+  number:
+    binary: echo
+    args: ["{{.value}}"]
+    params:
+      value: {pattern: "-?[0-9]+"}
+  option:
+    binary: echo
+    args: ["{{.value}}"]
+    params:
+      value: {allow_dash: true}
+`))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = catalog.Run(ctx, "show", map[string]any{"value": "--force"})
+	assert.ErrorContains(t, err, "starts with a dash")
+
+	_, argv, err := catalog.Prepare(ctx, "number", map[string]any{"value": "-5"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "-5"}, argv)
+
+	_, argv, err = catalog.Prepare(ctx, "option", map[string]any{"value": "--force"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo", "--force"}, argv)
+}
+
+func TestParseCatalog_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"undeclared parameter": `{"commands": {"x": {"binary": "echo", "args": ["{{.nope}}"]}}}`,
+		"bad template":         `{"commands": {"x": {"binary": "echo", "args": ["{{.x"]}}}`,
+		"no binary":            `{"commands": {"x": {"args": ["a"]}}}`,
+		"unknown type":         `{"commands": {"x": {"binary": "echo", "params": {"p": {"type": "float"}}}}}`,
+		"bad pattern":          `{"commands": {"x": {"binary": "echo", "params": {"p": {"pattern": "("}}}}}`,
+		"bad default":          `{"commands": {"x": {"binary": "echo", "params": {"p": {"type": "int", "default": "x"}}}}}`,
+		"unknown field":        `{"commands": {"x": {"binary": "echo", "shell": true}}}`,
+		"dash default":         `{"commands": {"x": {"binary": "echo", "params": {"p": {"default": "-x"}}}}}`,
+	}
+	for name, data := range tests {
+		_, err := ParseCatalog([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "catalog.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testCatalog), 0o600))
+
+	catalog, err := LoadCatalog(file)
+	require.NoError(t, err)
+	assert.Len(t, catalog.Commands, 3)
+}
+
+func TestCatalog_HandBuiltDefinitions(t *testing.T) {
+	catalog := &Catalog{Commands: map[string]*CommandDef{
+		"nobinary": {},
+		"uptime": {
+			Binary: "true",
+			Params: map[string]ParamDef{"host": {Pattern: "[a-z]+"}},
+		},
+	}}
+	ctx := context.Background()
+
+	_, err := catalog.Run(ctx, "nobinary", nil)
+	assert.ErrorContains(t, err, `command "nobinary": no binary`)
+
+	_, err = catalog.Run(ctx, "uptime", map[string]any{"host": "db1; reboot"})
+	assert.ErrorContains(t, err, "does not match")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := catalog.Run(ctx, "uptime", map[string]any{"host": "db"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
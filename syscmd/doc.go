@@ -22,4 +22,19 @@
 //
 //	err := syscmd.Quick().ExecuteQuiet("fast-command")     // 5s timeout
 //	err := syscmd.Resilient().ExecuteQuiet("slow-command") // 30s timeout, 3 retries
+//
+// Execution policy:
+//
+//	policy, err := syscmd.LoadPolicy("/etc/myapp/commands.yaml")
+//	syscmd.SetPolicy(policy) // or New(ctx).Policy(policy) for a single process
+//
+// Commands rejected by a policy fail before execution with an error matching
+// ErrPolicyDenied.
+//
+// Dry run:
+//
+//	rec := &syscmd.DryRunRecorder{}
+//	ctx = syscmd.WithDryRun(ctx, rec) // commands are recorded, not executed
+//	...
+//	rec.WriteTo(os.Stdout)
 package syscmd
@@ -0,0 +1,125 @@
+package syscmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// PlannedCommand is a fully resolved command recorded in dry-run mode
+type PlannedCommand struct {
+	Name string   // command name as passed to Execute
+	Path string   // executable found in PATH, empty if it could not be resolved
+	Args []string // arguments
+	Dir  string   // absolute working directory
+	Env  []string // variables set on top of the inherited environment
+}
+
+// String renders the command as a copy-pasteable shell line
+func (p PlannedCommand) String() string {
+	name := p.Name
+	if p.Path != "" {
+		name = p.Path
+	}
+	return Spec{Name: name, Args: p.Args, Env: p.Env, Dir: p.Dir}.String()
+}
+
+// DryRunRecorder collects the commands planned in dry-run mode.
+// The zero value is ready to use and it is safe for concurrent use.
+type DryRunRecorder struct {
+	// Respond returns the canned output and exit code for a planned command.
+	// Defaults to empty output and exit code 0.
+	Respond func(cmd PlannedCommand) (output string, exitCode int)
+
+	// Log receives one line per planned command when set
+	Log io.Writer
+
+	mu       sync.Mutex
+	commands []PlannedCommand
+}
+
+// Commands returns the planned commands in the order they were recorded
+func (r *DryRunRecorder) Commands() []PlannedCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]PlannedCommand(nil), r.commands...)
+}
+
+// WriteTo prints the numbered list of planned commands to w
+func (r *DryRunRecorder) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for i, cmd := range r.Commands() {
+		n, err := fmt.Fprintf(w, "%d. %s\n", i+1, cmd)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+type dryRunKey struct{}
+
+// WithDryRun enables dry-run mode for every Process created with the returned
+// context. rec collects the planned commands and may be nil.
+func WithDryRun(ctx context.Context, rec *DryRunRecorder) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, dryRunValue{rec})
+}
+
+type dryRunValue struct {
+	rec *DryRunRecorder
+}
+
+// dryRunRecorder reports whether dry-run mode is enabled and where to record
+func (c *Process) dryRunRecorder() (*DryRunRecorder, bool) {
+	if c.dryRun {
+		return c.recorder, true
+	}
+	if v, ok := c.ctx.Value(dryRunKey{}).(dryRunValue); ok {
+		return v.rec, true
+	}
+	return nil, false
+}
+
+// plan resolves the command, records it and fills res with the canned result
+func (c *Process) plan(rec *DryRunRecorder, res *Result) error {
+	cmd := PlannedCommand{
+		Name: res.Name,
+		Args: res.Args,
+		Dir:  c.dir,
+		Env:  append([]string(nil), c.env...),
+	}
+	if path, err := exec.LookPath(res.Name); err == nil {
+		cmd.Path, _ = filepath.Abs(path)
+	}
+	if cmd.Dir == "" {
+		cmd.Dir, _ = os.Getwd()
+	} else if abs, err := filepath.Abs(cmd.Dir); err == nil {
+		cmd.Dir = abs
+	}
+
+	res.DryRun = true
+	res.ExitCode = 0
+	if rec == nil {
+		return nil
+	}
+
+	rec.mu.Lock()
+	rec.commands = append(rec.commands, cmd)
+	rec.mu.Unlock()
+
+	if rec.Log != nil {
+		fmt.Fprintf(rec.Log, "dry run: %s\n", cmd)
+	}
+	if rec.Respond != nil {
+		res.Output, res.ExitCode = rec.Respond(cmd)
+		if res.ExitCode != 0 {
+			return fmt.Errorf("command failed: dry run exit code %d, output: %s", res.ExitCode, res.Output)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun_DoesNotExecute(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	rec := &DryRunRecorder{}
+
+	res, err := New(context.Background()).DryRun(rec).ExecuteResult("touch", marker)
+	require.NoError(t, err)
+	assert.True(t, res.DryRun)
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, 0, res.Attempts)
+
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err), "command must not run in dry-run mode")
+}
+
+func TestDryRun_RecordsResolvedCommand(t *testing.T) {
+	touch, err := exec.LookPath("touch")
+	require.NoError(t, err)
+	touch, _ = filepath.Abs(touch)
+
+	dir := t.TempDir()
+	var log bytes.Buffer
+	rec := &DryRunRecorder{Log: &log}
+
+	_, err = New(context.Background()).
+		Env("MODE=test").
+		Dir(dir).
+		DryRun(rec).
+		Execute("touch", "a")
+	require.NoError(t, err)
+
+	cmds := rec.Commands()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, PlannedCommand{
+		Name: "touch",
+		Path: touch,
+		Args: []string{"a"},
+		Dir:  dir,
+		Env:  []string{"MODE=test"},
+	}, cmds[0])
+	assert.Contains(t, log.String(), "dry run: cd "+dir+" && MODE=test "+touch+" a")
+}
+
+func TestDryRun_CannedResult(t *testing.T) {
+	rec := &DryRunRecorder{
+		Respond: func(cmd PlannedCommand) (string, int) {
+			if cmd.Name == "false" {
+				return "boom", 1
+			}
+			return "canned", 0
+		},
+	}
+	cmd := New(context.Background()).DryRun(rec)
+
+	output, err := cmd.Execute("uname", "-r")
+	require.NoError(t, err)
+	assert.Equal(t, "canned", output)
+
+	_, err = cmd.Execute("false")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
+
+func TestWithDryRun_Context(t *testing.T) {
+	rec := &DryRunRecorder{}
+	ctx := WithDryRun(context.Background(), rec)
+
+	_, err := Run(ctx, "rm", "-rf", "/tmp/does-not-matter")
+	require.NoError(t, err)
+	_, err = New(ctx).Execute("systemctl", "restart", "nginx")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	_, err = rec.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "1. cd ")
+	assert.Contains(t, out.String(), "rm -rf /tmp/does-not-matter\n2. cd ")
+	assert.Contains(t, out.String(), "systemctl restart nginx\n")
+}
+
+func TestDryRun_PolicyStillApplies(t *testing.T) {
+	p := &Policy{Rules: []Rule{{Binary: "echo"}}}
+	rec := &DryRunRecorder{}
+
+	_, err := New(context.Background()).Policy(p).DryRun(rec).Execute("rm", "-rf", "/")
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	assert.Empty(t, rec.Commands())
+}
+
+func TestDryRun_NotAudited(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(context.Background()).Audit(NewAuditLog(&buf, AuditOptions{})).DryRun(nil).Execute("true")
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
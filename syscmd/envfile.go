@@ -0,0 +1,293 @@
+package syscmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// EnvFile loads variables from dotenv or systemd EnvironmentFile style files
+// at each execution. Precedence, from lowest to highest: the inherited
+// environment, the files in the order given, then variables set with Env.
+// A missing or malformed file fails the execution.
+func (c *Process) EnvFile(paths ...string) *Process {
+	c = c.Clone()
+	c.envFiles = append(c.envFiles, paths...)
+	return c
+}
+
+// ExpandArgs replaces ${VAR} in arguments with the value of VAR set with
+// EnvFile or Env. The inherited environment is not used, so an argument
+// cannot pull in unrelated secrets of the Go process; still, do not enable it
+// for arguments from untrusted sources. The expansion is done by syscmd, never
+// by a shell: the result is always a single argument. The script of
+// ExecuteScript is left to the shell, only its positional arguments are
+// expanded. Referencing a variable that is not set fails the execution; $${
+// is replaced by a literal ${.
+func (c *Process) ExpandArgs() *Process {
+	c = c.Clone()
+	c.expandArgs = true
+	return c
+}
+
+// LoadEnvFile reads the KEY=VALUE pairs of an environment file, see ParseEnvFile
+func LoadEnvFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	env, err := ParseEnvFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse env file %s: %w", path, err)
+	}
+	return env, nil
+}
+
+// ParseEnvFile parses dotenv syntax into KEY=VALUE pairs in file order:
+//
+//	# comments, and ; comments as in systemd
+//	export KEY=value           # the export prefix is ignored
+//	UNQUOTED=trimmed value     # inline comments follow whitespace
+//	CONTINUED=first \
+//	  second                   # backslash continues unquoted values
+//	SINGLE='literal $value\n'  # no escapes
+//	DOUBLE="line\nnext \"quoted\""
+//
+// Double-quoted values support the \n, \r, \t, \", \\ and \$ escapes and,
+// like single-quoted values, may span lines. Values are never expanded.
+func ParseEnvFile(data []byte) ([]string, error) {
+	p := &envParser{src: strings.TrimPrefix(string(data), "\ufeff"), line: 1}
+	var env []string
+	for {
+		p.skip(" \t\r\n")
+		if p.eof() {
+			return env, nil
+		}
+		if c := p.peek(); c == '#' || c == ';' {
+			p.skipLine()
+			continue
+		}
+
+		if rest := p.src[p.pos:]; strings.HasPrefix(rest, "export ") || strings.HasPrefix(rest, "export\t") {
+			p.pos += len("export")
+			p.skip(" \t")
+		}
+		start := p.pos
+		for !p.eof() && !strings.ContainsRune("= \t\r\n", rune(p.peek())) {
+			p.pos++
+		}
+		key := p.src[start:p.pos]
+		if !isEnvName(key) {
+			return nil, p.errorf("invalid variable name %q", key)
+		}
+		p.skip(" \t")
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("expected '=' after %s", key)
+		}
+		p.pos++
+		p.skip(" \t")
+
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, key+"="+value)
+	}
+}
+
+type envParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *envParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *envParser) peek() byte { return p.src[p.pos] }
+
+func (p *envParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skip advances over the characters in set, counting lines
+func (p *envParser) skip(set string) {
+	for !p.eof() && strings.IndexByte(set, p.peek()) >= 0 {
+		if p.peek() == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+// skipLine advances past the end of the current line
+func (p *envParser) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+func (p *envParser) value() (string, error) {
+	if p.eof() {
+		return "", nil
+	}
+	switch p.peek() {
+	case '\'', '"':
+		quote := p.peek()
+		value, err := p.quoted(quote)
+		if err != nil {
+			return "", err
+		}
+		// only a comment may follow the closing quote
+		p.skip(" \t\r")
+		if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+			return "", p.errorf("unexpected %q after quoted value", p.peek())
+		}
+		p.skipLine()
+		return value, nil
+	default:
+		return p.unquoted(), nil
+	}
+}
+
+func (p *envParser) quoted(quote byte) (string, error) {
+	startLine := p.line
+	p.pos++
+	var b strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"' && !p.eof():
+			next := p.peek()
+			p.pos++
+			switch next {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(next)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(next)
+			}
+			if next == '\n' {
+				p.line++
+			}
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+		}
+	}
+	p.line = startLine
+	return "", p.errorf("unterminated %c-quoted value", quote)
+}
+
+func (p *envParser) unquoted() string {
+	var b strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == '\n':
+			return strings.TrimRight(b.String(), " \t\r")
+		case c == '#' && (b.Len() == 0 || strings.ContainsRune(" \t", rune(b.String()[b.Len()-1]))):
+			p.skipLine()
+			return strings.TrimRight(b.String(), " \t\r")
+		case c == '\\' && strings.HasPrefix(p.src[p.pos:], "\\\n"):
+			p.pos += 2
+			p.line++
+			continue
+		case c == '\\' && strings.HasPrefix(p.src[p.pos:], "\\\r\n"):
+			p.pos += 3
+			p.line++
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return strings.TrimRight(b.String(), " \t\r")
+}
+
+// resolveEnv returns a copy of c with the env files merged below the Env
+// variables and the arguments of res expanded when enabled
+func (c *Process) resolveEnv(res *Result) (*Process, error) {
+	if len(c.envFiles) == 0 && !c.expandArgs {
+		return c, nil
+	}
+
+	var fileEnv []string
+	for _, path := range c.envFiles {
+		env, err := LoadEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileEnv = append(fileEnv, env...)
+	}
+	resolved := c.Clone()
+	resolved.env = append(fileEnv, c.env...)
+	resolved.envFiles = nil
+
+	if c.expandArgs {
+		vars := make(map[string]string)
+		for _, kv := range resolved.env {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				vars[k] = v
+			}
+		}
+		args := slices.Clone(res.Args)
+		for i := c.scriptArgs; i < len(args); i++ {
+			expanded, err := expandArg(args[i], vars)
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand argument %d: %w", i+1, err)
+			}
+			args[i] = expanded
+		}
+		res.Args = args
+	}
+	return resolved, nil
+}
+
+// expandArg replaces ${VAR} references in arg
+func expandArg(arg string, vars map[string]string) (string, error) {
+	if !strings.Contains(arg, "${") {
+		return arg, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(arg, "${")
+		if i < 0 {
+			b.WriteString(arg)
+			return b.String(), nil
+		}
+		if i > 0 && arg[i-1] == '$' {
+			// $${ is an escaped ${
+			b.WriteString(arg[:i-1])
+			b.WriteString("${")
+			arg = arg[i+2:]
+			continue
+		}
+		b.WriteString(arg[:i])
+		end := strings.IndexByte(arg[i:], '}')
+		if end < 0 {
+			return "", errors.New("unterminated ${ reference")
+		}
+		name := arg[i+2 : i+end]
+		if !isEnvName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		value, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("variable %s is not set", name)
+		}
+		b.WriteString(value)
+		arg = arg[i+end+1:]
+	}
+}
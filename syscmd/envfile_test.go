@@ -0,0 +1,130 @@
+package syscmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	data := "\ufeff" + `# comment
+; systemd comment
+
+export EXPORTED=yes
+PLAIN = spaced value   # inline comment
+HASH=a#b
+EMPTY=
+SINGLE='literal $HOME\n # not a comment'
+DOUBLE="tab\tnew\nline \"quoted\" \$HOME \\ \q"
+MULTI="first
+second"
+CONTINUED=one \
+  two
+CRLF=windows` + "\r\n" + `LAST=end`
+
+	env, err := ParseEnvFile([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"EXPORTED=yes",
+		"PLAIN=spaced value",
+		"HASH=a#b",
+		"EMPTY=",
+		`SINGLE=literal $HOME\n # not a comment`,
+		"DOUBLE=tab\tnew\nline \"quoted\" $HOME \\ \\q",
+		"MULTI=first\nsecond",
+		"CONTINUED=one   two",
+		"CRLF=windows",
+		"LAST=end",
+	}, env)
+}
+
+func TestParseEnvFile_Errors(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{"1KEY=x", `line 1: invalid variable name "1KEY"`},
+		{"\nKEY x", "line 2: expected '=' after KEY"},
+		{"A=1\nKEY=\"open\nnext", "line 2: unterminated \"-quoted value"},
+		{"KEY='x' trailing", `line 1: unexpected 't' after quoted value`},
+		{"my-key=x", `line 1: invalid variable name "my-key"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseEnvFile([]byte(tt.data))
+		require.Error(t, err, tt.data)
+		assert.EqualError(t, err, tt.err)
+	}
+}
+
+func TestEnvFile_Precedence(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	t.Setenv("APP_INHERITED", "inherited")
+	t.Setenv("APP_NAME", "inherited")
+
+	override := filepath.Join(t.TempDir(), "override.env")
+	require.NoError(t, os.WriteFile(override, []byte("APP_GREETING=hi\n"), 0o600))
+
+	output, err := New(context.Background()).
+		EnvFile("testdata/app.env", override).
+		Env("APP_OVERRIDDEN=from-env").
+		Execute("sh", "-c", `echo "$APP_INHERITED|$APP_NAME|$APP_GREETING|$APP_OVERRIDDEN"`)
+	require.NoError(t, err)
+	assert.Equal(t, "inherited|demo|hi|from-env\n", output)
+}
+
+func TestEnvFile_Missing(t *testing.T) {
+	res, err := New(context.Background()).EnvFile("testdata/missing.env").ExecuteResult("true")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, 0, res.Attempts)
+}
+
+func TestExpandArgs(t *testing.T) {
+	res, err := New(context.Background()).
+		EnvFile("testdata/app.env").
+		Env("SYSCMD_HOST=example.com").
+		ExpandArgs().
+		ExecuteResult("echo", "${APP_GREETING}", "https://${SYSCMD_HOST}/x", "$${APP_NAME}", "$HOME;$(x)")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world https://example.com/x ${APP_NAME} $HOME;$(x)\n", res.Output)
+	assert.Equal(t, []string{"hello world", "https://example.com/x", "${APP_NAME}", "$HOME;$(x)"}, res.Args)
+
+	// without ExpandArgs arguments are passed as is
+	output, err := New(context.Background()).Execute("echo", "${SYSCMD_HOST}")
+	require.NoError(t, err)
+	assert.Equal(t, "${SYSCMD_HOST}\n", output)
+}
+
+func TestExpandArgs_Errors(t *testing.T) {
+	proc := New(context.Background()).ExpandArgs()
+
+	_, err := proc.Execute("echo", "${SYSCMD_SURELY_UNSET}")
+	assert.EqualError(t, err, "failed to expand argument 1: variable SYSCMD_SURELY_UNSET is not set")
+
+	_, err = proc.Execute("echo", "ok", "${open")
+	assert.EqualError(t, err, "failed to expand argument 2: unterminated ${ reference")
+
+	_, err = proc.Execute("echo", "${not-a-name}")
+	assert.EqualError(t, err, `failed to expand argument 1: invalid variable name "not-a-name"`)
+
+	// the inherited environment is not expanded
+	t.Setenv("SYSCMD_SECRET", "s3cr3t")
+	_, err = proc.Execute("echo", "${SYSCMD_SECRET}")
+	assert.EqualError(t, err, "failed to expand argument 1: variable SYSCMD_SECRET is not set")
+}
+
+func TestExpandArgs_Script(t *testing.T) {
+	res, err := New(context.Background()).
+		Env("GREETING=hello").
+		ExpandArgs().
+		ExecuteScript(`echo "${1}" "${GREETING}" "${UNSET:-fallback}"`, "${GREETING} world")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world hello fallback\n", res.Output)
+}
@@ -0,0 +1,15 @@
+package syscmd
+
+import "errors"
+
+var (
+	ErrPolicyDenied = errors.New("syscmd: command denied by policy")
+	ErrCircuitOpen  = errors.New("syscmd: circuit open")
+	ErrLocked       = errors.New("syscmd: lock held by another process")
+	ErrUnsafeSyntax = errors.New("syscmd: unsupported shell syntax")
+
+	ErrSandboxUnavailable   = errors.New("syscmd: sandbox unavailable")
+	ErrHardeningUnavailable = errors.New("syscmd: hardening unavailable")
+	ErrSeccompViolation     = errors.New("syscmd: system call denied by seccomp profile")
+	ErrShutdown             = errors.New("syscmd: command killed by shutdown")
+)
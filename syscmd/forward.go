@@ -0,0 +1,44 @@
+package syscmd
+
+import (
+	"os"
+	"os/signal"
+)
+
+// ForwardSignals relays sigs received by the Go process to the running
+// command, like a shell script ending in exec would. On Unix the command is
+// started in a process group of their own, see ProcessGroup, and the signals
+// are sent to the whole group, so it does not receive terminal signals twice
+// and its children are reached as well.
+//
+// Forwarding uses signal.Notify while the command runs: handlers registered
+// by the application keep receiving the signals, but when there are none
+// the default action, such as terminating on SIGINT, is suspended until the
+// command exits.
+func (c *Process) ForwardSignals(sigs ...os.Signal) *Process {
+	c = c.Clone()
+	c.forwardSignals = append([]os.Signal(nil), sigs...)
+	return c
+}
+
+// forward relays sigs to the process group of p until the returned function
+// is called
+func forward(p *os.Process, sigs []os.Signal) (stop func()) {
+	sigc := make(chan os.Signal, len(sigs))
+	signal.Notify(sigc, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigc:
+				signalGroup(p, sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigc)
+		close(done)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package syscmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardSignals(t *testing.T) {
+	// the application keeps its own handler, which also keeps the test
+	// process alive should the signal arrive after forwarding stopped
+	appc := make(chan os.Signal, 1)
+	signal.Notify(appc, syscall.SIGUSR1)
+	defer signal.Stop(appc)
+
+	ready := filepath.Join(t.TempDir(), "ready")
+	script := `trap 'echo got USR1; exit 3' USR1; touch "$1"; while :; do sleep 0.05; done`
+
+	type outcome struct {
+		res *Result
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := New(context.Background()).
+			Timeout(5*time.Second).
+			ForwardSignals(syscall.SIGUSR1).
+			ExecuteResult("sh", "-c", script, "sh", ready)
+		done <- outcome{res, err}
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(ready)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	select {
+	case out := <-done:
+		require.Error(t, out.err)
+		assert.Equal(t, 3, out.res.ExitCode)
+		assert.Contains(t, out.res.Output, "got USR1")
+	case <-time.After(3 * time.Second):
+		t.Fatal("signal was not forwarded")
+	}
+
+	select {
+	case <-appc:
+	case <-time.After(time.Second):
+		t.Fatal("the application handler did not receive the signal")
+	}
+}
+
+func TestForwardSignals_OwnProcessGroup(t *testing.T) {
+	ctx := context.Background()
+	cmd := New(ctx).ForwardSignals(syscall.SIGTERM).command(ctx, "true", nil, nil, nil)
+	require.NotNil(t, cmd.SysProcAttr)
+	assert.True(t, cmd.SysProcAttr.Setpgid)
+}
@@ -0,0 +1,72 @@
+package syscmd
+
+import "syscall"
+
+// hardeningStageName prefixes the errors of the hardening stage of a sandboxed command
+const hardeningStageName = "syscmd-hardening"
+
+// HardeningOptions configures the privilege restrictions of a hardened command
+type HardeningOptions struct {
+	// Seccomp lists the system calls the command may not make. Defaults to
+	// DefaultSeccompProfile.
+	Seccomp *SeccompProfile
+}
+
+// SeccompProfile is a deny list of system calls enforced with a seccomp filter
+type SeccompProfile struct {
+	// Deny lists system call names, for example "ptrace" or "mount". Denying
+	// "clone" only denies creating namespaces with it; "clone3", whose flags
+	// cannot be inspected, fails with ENOSYS so that libc falls back to clone.
+	// Calls that do not exist on the architecture are ignored.
+	Deny []string
+
+	// Errno makes blocked calls fail with this error instead of killing the
+	// command. When zero, the command is killed and execution fails with
+	// ErrSeccompViolation.
+	Errno syscall.Errno
+}
+
+// DefaultSeccompProfile returns the built-in profile denying debugging other
+// processes, mounting, creating namespaces, loading kernel code, rebooting
+// and similar calls that helper commands have no business making
+func DefaultSeccompProfile() *SeccompProfile {
+	return &SeccompProfile{Deny: []string{
+		"ptrace", "process_vm_readv", "process_vm_writev",
+		"mount", "umount2", "pivot_root", "chroot", "unshare", "setns", "clone", "clone3",
+		"fsopen", "fsconfig", "fsmount", "fspick", "move_mount", "open_tree",
+		"kexec_load", "kexec_file_load", "init_module", "finit_module", "delete_module",
+		"reboot", "swapon", "swapoff", "acct",
+		"bpf", "perf_event_open", "userfaultfd", "open_by_handle_at",
+		"add_key", "request_key", "keyctl",
+		"settimeofday", "clock_settime", "syslog",
+	}}
+}
+
+// Hardening restricts the privileges of the command: it sets no_new_privs so
+// setuid binaries and file capabilities are not honored, drops all
+// capabilities and installs a seccomp filter from opts.Seccomp. The
+// restrictions are inherited by everything the command starts.
+//
+// A command killed for making a denied call fails with ErrSeccompViolation;
+// only the started process itself is detected, a shell reports a killed
+// child as exit code 159. Hardening requires Linux, elsewhere execution fails
+// with ErrHardeningUnavailable.
+//
+// Combined with Sandbox, the restrictions are applied once the sandbox is set
+// up: the sandbox runs the current executable as an intermediate stage, which
+// the init function of this package turns into restricting itself and
+// executing the command. Programs must not start work depending on the
+// environment variable _SYSCMD_HARDENING_STAGE before that.
+func (c *Process) Hardening(opts HardeningOptions) *Process {
+	c = c.Clone()
+	c.hardening = &opts
+	return c
+}
+
+// profile returns the configured profile or the default one
+func (h *HardeningOptions) profile() *SeccompProfile {
+	if h.Seccomp != nil {
+		return h.Seccomp
+	}
+	return DefaultSeccompProfile()
+}
@@ -0,0 +1,7 @@
+//go:build linux && !386
+
+package syscmd
+
+import "golang.org/x/sys/unix"
+
+const sysKexecFileLoad = unix.SYS_KEXEC_FILE_LOAD
@@ -0,0 +1,4 @@
+package syscmd
+
+// kexec_file_load does not exist on 386
+const sysKexecFileLoad = noSyscall
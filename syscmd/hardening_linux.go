@@ -0,0 +1,343 @@
+package syscmd
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// noSyscall marks a system call that does not exist on the current
+// architecture, denying it is a no-op
+const noSyscall = ^uintptr(0)
+
+// syscallNumbers maps the system calls a SeccompProfile may deny to their
+// numbers on the current architecture
+var syscallNumbers = map[string]uintptr{
+	"acct":              unix.SYS_ACCT,
+	"add_key":           unix.SYS_ADD_KEY,
+	"bpf":               unix.SYS_BPF,
+	"chroot":            unix.SYS_CHROOT,
+	"clock_settime":     unix.SYS_CLOCK_SETTIME,
+	"clone":             unix.SYS_CLONE,
+	"clone3":            unix.SYS_CLONE3,
+	"delete_module":     unix.SYS_DELETE_MODULE,
+	"finit_module":      unix.SYS_FINIT_MODULE,
+	"fsconfig":          unix.SYS_FSCONFIG,
+	"fsmount":           unix.SYS_FSMOUNT,
+	"fsopen":            unix.SYS_FSOPEN,
+	"fspick":            unix.SYS_FSPICK,
+	"init_module":       unix.SYS_INIT_MODULE,
+	"kexec_file_load":   sysKexecFileLoad,
+	"kexec_load":        unix.SYS_KEXEC_LOAD,
+	"keyctl":            unix.SYS_KEYCTL,
+	"mount":             unix.SYS_MOUNT,
+	"move_mount":        unix.SYS_MOVE_MOUNT,
+	"open_by_handle_at": unix.SYS_OPEN_BY_HANDLE_AT,
+	"open_tree":         unix.SYS_OPEN_TREE,
+	"perf_event_open":   unix.SYS_PERF_EVENT_OPEN,
+	"pivot_root":        unix.SYS_PIVOT_ROOT,
+	"process_vm_readv":  unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev": unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":            unix.SYS_PTRACE,
+	"reboot":            unix.SYS_REBOOT,
+	"request_key":       unix.SYS_REQUEST_KEY,
+	"setns":             unix.SYS_SETNS,
+	"settimeofday":      unix.SYS_SETTIMEOFDAY,
+	"swapoff":           unix.SYS_SWAPOFF,
+	"swapon":            unix.SYS_SWAPON,
+	"syslog":            unix.SYS_SYSLOG,
+	"umount2":           unix.SYS_UMOUNT2,
+	"unshare":           unix.SYS_UNSHARE,
+	"userfaultfd":       unix.SYS_USERFAULTFD,
+}
+
+// auditArch identifies the system call convention checked by the filter
+var auditArch = map[string]uint32{
+	"386":     unix.AUDIT_ARCH_I386,
+	"amd64":   unix.AUDIT_ARCH_X86_64,
+	"arm":     unix.AUDIT_ARCH_ARM,
+	"arm64":   unix.AUDIT_ARCH_AARCH64,
+	"loong64": unix.AUDIT_ARCH_LOONGARCH64,
+	"ppc64le": unix.AUDIT_ARCH_PPC64LE,
+	"riscv64": unix.AUDIT_ARCH_RISCV64,
+	"s390x":   unix.AUDIT_ARCH_S390X,
+}
+
+// x32SyscallBit marks calls of the x32 ABI, which share the amd64 audit arch
+const x32SyscallBit = 0x40000000
+
+// cloneNamespaceFlags are the flags of clone creating namespaces.
+// CLONE_NEWTIME is only accepted by clone3 and unshare.
+const cloneNamespaceFlags = unix.CLONE_NEWNS | unix.CLONE_NEWCGROUP | unix.CLONE_NEWUTS |
+	unix.CLONE_NEWIPC | unix.CLONE_NEWUSER | unix.CLONE_NEWPID | unix.CLONE_NEWNET
+
+// hardener starts commands with the restrictions of HardeningOptions
+type hardener struct {
+	filter []unix.SockFilter
+}
+
+// compile translates the seccomp profile into a BPF program
+func (h *HardeningOptions) compile() (*hardener, error) {
+	arch, ok := auditArch[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("%w: seccomp is not supported on %s", ErrHardeningUnavailable, runtime.GOARCH)
+	}
+
+	profile := h.profile()
+	deny := uint32(unix.SECCOMP_RET_KILL_PROCESS)
+	if profile.Errno != 0 {
+		deny = unix.SECCOMP_RET_ERRNO | uint32(profile.Errno)&unix.SECCOMP_RET_DATA
+	}
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jeq := func(k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: jt, Jf: jf, K: k}
+	}
+
+	// offsets in struct seccomp_data
+	const nrOffset, archOffset, argsOffset = 0, 4, 16
+	// the flags of clone are its first argument, the second on s390x; the
+	// filter reads the low 32 bits, which hold every namespace flag
+	cloneFlagsOffset := uint32(argsOffset)
+	if runtime.GOARCH == "s390x" {
+		cloneFlagsOffset += 8
+	}
+	if binary.NativeEndian.Uint16([]byte{0, 1}) == 1 {
+		cloneFlagsOffset += 4 // big endian
+	}
+
+	filter := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, archOffset),
+		jeq(arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, nrOffset),
+	}
+	if runtime.GOARCH == "amd64" {
+		filter = append(filter,
+			unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: 0, Jf: 1, K: x32SyscallBit},
+			stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		)
+	}
+	for _, name := range profile.Deny {
+		nr, ok := syscallNumbers[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid seccomp profile: unknown system call %q", name)
+		}
+		switch {
+		case nr == noSyscall:
+		case name == "clone":
+			filter = append(filter,
+				jeq(uint32(nr), 0, 4),
+				stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, cloneFlagsOffset),
+				unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, Jt: 0, Jf: 1, K: cloneNamespaceFlags},
+				stmt(unix.BPF_RET|unix.BPF_K, deny),
+				stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, nrOffset),
+			)
+		case name == "clone3":
+			// its flags are behind a pointer the filter cannot read
+			filter = append(filter, jeq(uint32(nr), 0, 1), stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)))
+		default:
+			filter = append(filter, jeq(uint32(nr), 0, 1), stmt(unix.BPF_RET|unix.BPF_K, deny))
+		}
+	}
+	filter = append(filter, stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW))
+	return &hardener{filter: filter}, nil
+}
+
+// start restricts a dedicated OS thread and starts cmd from it so the child
+// inherits the restrictions. The thread is kept until release is called, as
+// the parent death signal fires when the starting thread exits; it is never
+// unlocked, the runtime discards it when the goroutine returns.
+func (h *hardener) start(cmd *exec.Cmd) (release func(), err error) {
+	errc := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		if err := h.restrictThread(); err != nil {
+			errc <- fmt.Errorf("%w: %w", ErrHardeningUnavailable, err)
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			errc <- err
+			return
+		}
+		errc <- nil
+		<-done
+	}()
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return func() { close(done) }, nil
+}
+
+// restrictThread drops the capabilities of the calling thread and installs
+// the seccomp filter, if any
+func (h *hardener) restrictThread() error {
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && err != unix.EINVAL {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", err)
+	}
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to read capabilities: %w", err)
+	}
+	data[0].Inheritable, data[1].Inheritable = 0, 0
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("failed to clear inheritable capabilities: %w", err)
+	}
+
+	for capability := 0; ; capability++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0)
+		if err == unix.EINVAL {
+			break
+		}
+		if err == unix.EPERM {
+			// without CAP_SETPCAP the bounding set cannot be changed
+			if err := boundingSetHarmless(capability); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to drop capability %d: %w", capability, err)
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	if len(h.filter) == 0 {
+		return nil
+	}
+	prog := unix.SockFprog{Len: uint16(len(h.filter)), Filter: &h.filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("failed to install seccomp filter: %w", err)
+	}
+	return nil
+}
+
+// boundingSetHarmless checks that a bounding set that could not be cleared
+// from capability on grants nothing on exec. A uid 0 child regains its
+// permitted set from the bounding set, so it must already be empty; other
+// children only gain capabilities from setuid binaries and file capabilities,
+// which no_new_privs disables.
+func boundingSetHarmless(capability int) error {
+	ruid, euid, suid := unix.Getresuid()
+	if ruid != 0 && euid != 0 && suid != 0 {
+		return nil
+	}
+	for ; ; capability++ {
+		set, err := unix.PrctlRetInt(unix.PR_CAPBSET_READ, uintptr(capability), 0, 0, 0)
+		if err == unix.EINVAL {
+			return nil
+		}
+		if err != nil || set != 0 {
+			return fmt.Errorf("failed to drop capability %d from the bounding set without CAP_SETPCAP", capability)
+		}
+	}
+}
+
+// hardeningStageEnv carries the filter to the hardening stage of a sandboxed
+// command, empty when the stage only drops capabilities
+const hardeningStageEnv = "_SYSCMD_HARDENING_STAGE"
+
+// Descriptors of a sandboxed command: the sandbox setup pipe and the
+// executable of the hardening stage
+const (
+	setupFD = 3
+	stageFD = 4
+)
+
+// A sandboxed command cannot be restricted when it starts, the sandbox still
+// needs to mount file systems. Instead the sandbox wrapper runs the current
+// executable as a hardening stage once the mounts are done; this init
+// function intercepts it before main, restricts the thread and execs the
+// command.
+func init() {
+	if encoded, ok := os.LookupEnv(hardeningStageEnv); ok {
+		runHardeningStage(encoded, os.Args[1:])
+	}
+}
+
+// stage returns the environment variable and the command line prefix running
+// a command through the hardening stage. The stage executable is passed as
+// descriptor 4 by stageExecutable, it may not be reachable by path inside the
+// sandbox.
+func (h *hardener) stage() (env string, argv []string) {
+	buf := make([]byte, 0, 8*len(h.filter))
+	for _, f := range h.filter {
+		buf = binary.LittleEndian.AppendUint16(buf, f.Code)
+		buf = append(buf, f.Jt, f.Jf)
+		buf = binary.LittleEndian.AppendUint32(buf, f.K)
+	}
+	env = hardeningStageEnv + "=" + base64.StdEncoding.EncodeToString(buf)
+	return env, []string{fmt.Sprintf("/proc/self/fd/%d", stageFD)}
+}
+
+// stageExecutable opens the current executable to be passed to the sandbox
+func stageExecutable() (*os.File, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the executable for the sandbox: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the executable for the sandbox: %w", err)
+	}
+	return f, nil
+}
+
+// runHardeningStage restricts the process and replaces it with argv. Setup
+// failures are reported on the sandbox setup pipe; like a shell it exits with
+// 127 when the command is not found and 126 when it cannot be executed.
+func runHardeningStage(encoded string, argv []string) {
+	os.Unsetenv(hardeningStageEnv)
+	runtime.LockOSThread()
+
+	fail := func(code int, to *os.File, format string, args ...any) {
+		fmt.Fprintf(to, hardeningStageName+": "+format+"\n", args...)
+		os.Exit(code)
+	}
+	setup := os.NewFile(setupFD, "setup")
+
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(buf)%8 != 0 || len(argv) == 0 {
+		fail(1, setup, "invalid invocation")
+	}
+	h := &hardener{filter: make([]unix.SockFilter, len(buf)/8)}
+	for i := range h.filter {
+		b := buf[i*8:]
+		h.filter[i] = unix.SockFilter{Code: binary.LittleEndian.Uint16(b), Jt: b[2], Jf: b[3], K: binary.LittleEndian.Uint32(b[4:])}
+	}
+	if err := h.restrictThread(); err != nil {
+		fail(1, setup, "%v", err)
+	}
+
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		fail(127, os.Stderr, "%s: not found", argv[0])
+	}
+	unix.CloseOnExec(setupFD)
+	unix.CloseOnExec(stageFD)
+	err = syscall.Exec(path, argv, os.Environ())
+	fail(126, os.Stderr, "%s: %v", argv[0], err)
+}
+
+// killedBySeccomp reports whether cmd was killed for making a denied call
+func killedBySeccomp(cmd *exec.Cmd) bool {
+	if cmd.ProcessState == nil {
+		return false
+	}
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGSYS
+}
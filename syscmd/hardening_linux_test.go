@@ -0,0 +1,190 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// procStatus returns a field of /proc/self/status as seen by a command
+func procStatus(t *testing.T, proc *Process, field string) string {
+	t.Helper()
+	output, err := proc.Execute("cat", "/proc/self/status")
+	if errors.Is(err, ErrHardeningUnavailable) {
+		t.Skipf("hardening unavailable: %v", err)
+	}
+	require.NoError(t, err)
+	m := regexp.MustCompile(`(?m)^` + field + `:\s*(\S+)$`).FindStringSubmatch(output)
+	require.NotNil(t, m, "field %s missing in:\n%s", field, output)
+	return m[1]
+}
+
+func TestHardening_RestrictsChild(t *testing.T) {
+	proc := New(context.Background()).Hardening(HardeningOptions{})
+
+	assert.Equal(t, "1", procStatus(t, proc, "NoNewPrivs"))
+	assert.Equal(t, "2", procStatus(t, proc, "Seccomp"))
+	assert.Equal(t, "0000000000000000", procStatus(t, proc, "CapEff"))
+	assert.Equal(t, "0000000000000000", procStatus(t, proc, "CapPrm"))
+
+	// the parent and later commands are not affected
+	assert.Equal(t, "0", procStatus(t, New(context.Background()), "NoNewPrivs"))
+}
+
+func TestHardening_ViolationKillsCommand(t *testing.T) {
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip("unshare not installed")
+	}
+
+	res, err := New(context.Background()).
+		Hardening(HardeningOptions{}).
+		Retry(2, 0).
+		ExecuteResult("unshare", "--user", "true")
+	if errors.Is(err, ErrHardeningUnavailable) {
+		t.Skipf("hardening unavailable: %v", err)
+	}
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrSeccompViolation)
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Equal(t, 1, res.Attempts, "violations are not retried")
+}
+
+func TestHardening_CustomProfileErrno(t *testing.T) {
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip("unshare not installed")
+	}
+
+	res, err := New(context.Background()).
+		Hardening(HardeningOptions{Seccomp: &SeccompProfile{Deny: []string{"unshare"}, Errno: syscall.EPERM}}).
+		ExecuteResult("unshare", "--user", "true")
+	if errors.Is(err, ErrHardeningUnavailable) {
+		t.Skipf("hardening unavailable: %v", err)
+	}
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrSeccompViolation)
+	assert.Equal(t, 1, res.ExitCode)
+	assert.Contains(t, res.Output, "Operation not permitted")
+}
+
+// syscallScript makes the system call given as argv[1] with the integer
+// arguments that follow and prints the result
+const syscallScript = `
+import ctypes, os, sys
+libc = ctypes.CDLL(None, use_errno=True)
+r = libc.syscall(*[ctypes.c_long(int(a)) for a in sys.argv[1:]])
+if r == 0 and int(sys.argv[1]) == ` + "%d" + `:
+    os._exit(0)
+if r > 0:
+    os.waitpid(r, 0)
+print(os.strerror(ctypes.get_errno()) if r < 0 else "ok")
+`
+
+func TestHardening_DefaultProfileDeniesEscapes(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not installed")
+	}
+	if runtime.GOARCH == "s390x" {
+		t.Skip("the clone arguments are swapped on s390x")
+	}
+	proc := New(context.Background()).Hardening(HardeningOptions{
+		Seccomp: &SeccompProfile{Deny: DefaultSeccompProfile().Deny, Errno: syscall.EPERM},
+	})
+	script := fmt.Sprintf(syscallScript, unix.SYS_CLONE)
+	call := func(args ...int) string {
+		t.Helper()
+		argv := []string{"-c", script}
+		for _, a := range args {
+			argv = append(argv, strconv.Itoa(a))
+		}
+		output, err := proc.Execute("python3", argv...)
+		if errors.Is(err, ErrHardeningUnavailable) {
+			t.Skipf("hardening unavailable: %v", err)
+		}
+		require.NoError(t, err)
+		return strings.TrimSpace(output)
+	}
+
+	sigchld := int(syscall.SIGCHLD)
+	assert.Equal(t, "ok", call(unix.SYS_CLONE, sigchld), "clone without namespaces is allowed")
+	assert.Equal(t, "Operation not permitted", call(unix.SYS_CLONE, unix.CLONE_NEWUSER|sigchld))
+	assert.Equal(t, "Operation not permitted", call(unix.SYS_CLONE, unix.CLONE_NEWNS|sigchld))
+	assert.Equal(t, "Function not implemented", call(unix.SYS_CLONE3, 0, 0), "clone3 makes libc fall back to clone")
+	assert.Equal(t, "Operation not permitted", call(unix.SYS_FSOPEN, 0, 0))
+	assert.Equal(t, "Operation not permitted", call(unix.SYS_OPEN_TREE, -100, 0, 0))
+	assert.Equal(t, "Operation not permitted", call(unix.SYS_MOVE_MOUNT, -100, 0, -100, 0, 0))
+	if nr := uintptr(sysKexecFileLoad); nr != noSyscall {
+		assert.Equal(t, "Operation not permitted", call(int(nr), -1, -1, 0, 0, 0))
+	}
+}
+
+func TestHardening_BoundingSetWithoutSetpcap(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	h, err := (&HardeningOptions{}).compile()
+	require.NoError(t, err)
+
+	errc := make(chan error, 1)
+	go func() {
+		// the thread is never unlocked, the runtime discards it
+		runtime.LockOSThread()
+		hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+		var data [2]unix.CapUserData
+		if err := unix.Capget(&hdr, &data[0]); err != nil {
+			errc <- err
+			return
+		}
+		data[0].Effective &^= 1 << unix.CAP_SETPCAP
+		data[0].Permitted &^= 1 << unix.CAP_SETPCAP
+		if err := unix.Capset(&hdr, &data[0]); err != nil {
+			errc <- err
+			return
+		}
+		errc <- h.restrictThread()
+	}()
+	assert.ErrorContains(t, <-errc, "bounding set without CAP_SETPCAP",
+		"a uid 0 child would regain the capabilities of the bounding set")
+}
+
+func TestHardening_InvalidConfiguration(t *testing.T) {
+	_, err := New(context.Background()).
+		Hardening(HardeningOptions{Seccomp: &SeccompProfile{Deny: []string{"no_such_call"}}}).
+		Execute("true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown system call "no_such_call"`)
+}
+
+func TestHardening_WithSandbox(t *testing.T) {
+	proc := New(context.Background()).Sandbox(SandboxOptions{}).Hardening(HardeningOptions{})
+	if _, err := proc.Execute("true"); errors.Is(err, ErrSandboxUnavailable) {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+
+	// the restrictions apply to the command, after the sandbox mounts
+	assert.Equal(t, "1", procStatus(t, proc, "NoNewPrivs"))
+	assert.Equal(t, "2", procStatus(t, proc, "Seccomp"))
+	assert.Equal(t, "0000000000000000", procStatus(t, proc, "CapEff"))
+	output, err := proc.Execute("sh", "-c", `echo $$; printenv `+hardeningStageEnv+` || echo clean`)
+	require.NoError(t, err)
+	assert.Equal(t, "1\nclean\n", output)
+
+	res, err := proc.Retry(2, 0).ExecuteResult("umount", "/tmp")
+	require.ErrorIs(t, err, ErrSeccompViolation)
+	assert.Equal(t, 1, res.Attempts)
+
+	res, err = proc.ExecuteResult("no-such-binary-xyz")
+	require.Error(t, err)
+	assert.Equal(t, 127, res.ExitCode)
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package syscmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// hardener starts commands with the restrictions of HardeningOptions
+type hardener struct{}
+
+func (h *HardeningOptions) compile() (*hardener, error) {
+	return nil, fmt.Errorf("%w: seccomp is only available on Linux", ErrHardeningUnavailable)
+}
+
+func (h *hardener) start(cmd *exec.Cmd) (func(), error) {
+	return func() {}, cmd.Start()
+}
+
+func (h *hardener) stage() (string, []string) {
+	return "", nil
+}
+
+func stageExecutable() (*os.File, error) {
+	return nil, fmt.Errorf("the hardening stage is only available on Linux")
+}
+
+func killedBySeccomp(*exec.Cmd) bool {
+	return false
+}
@@ -0,0 +1,112 @@
+package syscmd
+
+import (
+	"context"
+	"time"
+)
+
+// Execution describes a command execution reported to Hooks
+type Execution struct {
+	Name  string
+	Args  []string
+	Dir   string
+	Start time.Time
+
+	hooks hookList
+	tee   *teeExecution // writer to the TeeToFile log, nil when not teed
+}
+
+// Attempt describes a single run of the command within an execution
+type Attempt struct {
+	Number int // starting at 1
+	Start  time.Time
+
+	// Env holds variables added for this attempt only. OnAttempt hooks may
+	// append to it, for example to propagate a trace context.
+	Env []string
+}
+
+// Hooks are called at the stages of every execution of a Process, for
+// instrumentation such as metrics, tracing and logging. All fields are
+// optional. Hooks are not called in dry-run mode.
+//
+// The context returned by OnStart is passed to the attempt hooks and to
+// OnFinish; the one returned by OnAttempt to OnAttemptDone. Hooks may use
+// them to carry state between stages but must derive them from the context
+// they were given.
+type Hooks struct {
+	// OnStart is called before the policy check and any waiting
+	OnStart func(ctx context.Context, e *Execution) context.Context
+
+	// OnAttempt is called before the command is started
+	OnAttempt func(ctx context.Context, e *Execution, a *Attempt) context.Context
+
+	// OnAttemptDone is called when the command exited or failed to start
+	OnAttemptDone func(ctx context.Context, e *Execution, a *Attempt, res *Result, err error)
+
+	// OnRetry is called after a failed attempt with the delay before the next one
+	OnRetry func(ctx context.Context, e *Execution, err error, delay time.Duration)
+
+	// OnFinish is called with the final result of the execution
+	OnFinish func(ctx context.Context, e *Execution, res *Result, err error)
+}
+
+// Hooks adds instrumentation hooks. Hooks added later run later at each stage.
+func (c *Process) Hooks(h Hooks) *Process {
+	c = c.Clone()
+	c.hooks = append(c.hooks, h)
+	return c
+}
+
+// instrumentation returns the hooks of c followed by the logging hooks
+func (c *Process) instrumentation() hookList {
+	if c.logger == nil {
+		return c.hooks
+	}
+	return append(c.hooks[:len(c.hooks):len(c.hooks)], logHooks(c.logger))
+}
+
+// hookList runs the stages of every registered Hooks in order
+type hookList []Hooks
+
+func (l hookList) start(ctx context.Context, e *Execution) context.Context {
+	for _, h := range l {
+		if h.OnStart != nil {
+			ctx = h.OnStart(ctx, e)
+		}
+	}
+	return ctx
+}
+
+func (l hookList) attempt(ctx context.Context, e *Execution, a *Attempt) context.Context {
+	for _, h := range l {
+		if h.OnAttempt != nil {
+			ctx = h.OnAttempt(ctx, e, a)
+		}
+	}
+	return ctx
+}
+
+func (l hookList) attemptDone(ctx context.Context, e *Execution, a *Attempt, res *Result, err error) {
+	for _, h := range l {
+		if h.OnAttemptDone != nil {
+			h.OnAttemptDone(ctx, e, a, res, err)
+		}
+	}
+}
+
+func (l hookList) retry(ctx context.Context, e *Execution, err error, delay time.Duration) {
+	for _, h := range l {
+		if h.OnRetry != nil {
+			h.OnRetry(ctx, e, err, delay)
+		}
+	}
+}
+
+func (l hookList) finish(ctx context.Context, e *Execution, res *Result, err error) {
+	for _, h := range l {
+		if h.OnFinish != nil {
+			h.OnFinish(ctx, e, res, err)
+		}
+	}
+}
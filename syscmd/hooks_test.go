@@ -0,0 +1,80 @@
+package syscmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type hookKey struct{}
+
+func TestHooks_Stages(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, fmt.Sprintf(format, args...))
+	}
+
+	hooks := Hooks{
+		OnStart: func(ctx context.Context, e *Execution) context.Context {
+			record("start %s", e.Name)
+			return context.WithValue(ctx, hookKey{}, "exec")
+		},
+		OnAttempt: func(ctx context.Context, e *Execution, a *Attempt) context.Context {
+			record("attempt %d %v", a.Number, ctx.Value(hookKey{}))
+			a.Env = append(a.Env, fmt.Sprintf("ATTEMPT=%d", a.Number))
+			return ctx
+		},
+		OnAttemptDone: func(ctx context.Context, e *Execution, a *Attempt, res *Result, err error) {
+			record("done %d exit=%d output=%q", a.Number, res.ExitCode, res.Output)
+		},
+		OnRetry: func(ctx context.Context, e *Execution, err error, delay time.Duration) {
+			record("retry %t", delay > 0)
+		},
+		OnFinish: func(ctx context.Context, e *Execution, res *Result, err error) {
+			record("finish attempts=%d err=%t", res.Attempts, err != nil)
+		},
+	}
+
+	_, err := New(context.Background()).
+		Hooks(hooks).
+		Retry(1, 10*time.Millisecond).
+		Execute("sh", "-c", `echo "$ATTEMPT"; exit 1`)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"start sh",
+		"attempt 1 exec",
+		`done 1 exit=1 output="1\n"`,
+		"retry true",
+		"attempt 2 exec",
+		`done 2 exit=1 output="2\n"`,
+		"finish attempts=2 err=true",
+	}, events)
+}
+
+func TestHooks_NotCalledInDryRun(t *testing.T) {
+	called := false
+	_, err := New(context.Background()).
+		Hooks(Hooks{OnStart: func(ctx context.Context, e *Execution) context.Context {
+			called = true
+			return ctx
+		}}).
+		DryRun(nil).
+		Execute("true")
+	require.NoError(t, err)
+	assert.False(t, called)
+}
+
+func TestExecute_TimeoutError(t *testing.T) {
+	_, err := New(context.Background()).Timeout(50*time.Millisecond).Execute("sleep", "5")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
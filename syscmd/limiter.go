@@ -0,0 +1,172 @@
+package syscmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Limit configures how often and how many instances of a command may run
+type Limit struct {
+	// Concurrency is the maximum number of simultaneous executions. Zero means unlimited.
+	Concurrency int
+
+	// Rate is the number of attempts allowed per Per. Zero means unlimited.
+	Rate int
+	Per  time.Duration
+
+	// Burst is the number of attempts that may start back to back. Defaults to 1.
+	Burst int
+}
+
+// Limiter bounds concurrency and rate of executions per key. By default the
+// key is the base name of the binary. It is safe for concurrent use.
+type Limiter struct {
+	mu     sync.Mutex
+	limits map[string]Limit
+	def    Limit
+	keyFn  func(name string, args []string) string
+	states map[string]*limitState
+}
+
+type limitState struct {
+	sem    chan struct{}
+	bucket *tokenBucket
+}
+
+// NewLimiter creates a limiter without any limits
+func NewLimiter() *Limiter {
+	return &Limiter{
+		limits: make(map[string]Limit),
+		keyFn: func(name string, _ []string) string {
+			return filepath.Base(name)
+		},
+		states: make(map[string]*limitState),
+	}
+}
+
+// Set configures the limit of a key. It must be called before the key is first used.
+func (l *Limiter) Set(key string, limit Limit) *Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[key] = limit
+	return l
+}
+
+// Default configures the limit of keys without an explicit limit
+func (l *Limiter) Default(limit Limit) *Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def = limit
+	return l
+}
+
+// Key sets the function mapping a command to its limiter key
+func (l *Limiter) Key(fn func(name string, args []string) string) *Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keyFn = fn
+	return l
+}
+
+func (l *Limiter) state(name string, args []string) *limitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := l.keyFn(name, args)
+	if st, ok := l.states[key]; ok {
+		return st
+	}
+
+	limit, ok := l.limits[key]
+	if !ok {
+		limit = l.def
+	}
+	st := &limitState{}
+	if limit.Concurrency > 0 {
+		st.sem = make(chan struct{}, limit.Concurrency)
+	}
+	if limit.Rate > 0 && limit.Per > 0 {
+		st.bucket = newTokenBucket(limit.Rate, limit.Per, limit.Burst)
+	}
+	l.states[key] = st
+	return st
+}
+
+// acquire waits for a concurrency slot and returns the function releasing it
+func (st *limitState) acquire(ctx context.Context) (func(), error) {
+	if st.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case st.sem <- struct{}{}:
+		return func() { <-st.sem }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for concurrency limit: %w", ctx.Err())
+	}
+}
+
+// wait blocks until the rate limit allows another attempt
+func (st *limitState) wait(ctx context.Context) error {
+	if st.bucket == nil {
+		return nil
+	}
+	if err := st.bucket.wait(ctx); err != nil {
+		return fmt.Errorf("waiting for rate limit: %w", err)
+	}
+	return nil
+}
+
+// tokenBucket refills rate tokens every per, holding at most burst tokens
+type tokenBucket struct {
+	mu       sync.Mutex
+	interval time.Duration // time to refill one token
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate int, per time.Duration, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		interval: per / time.Duration(rate),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// wait reserves a token, sleeping until it is available. The reservation is
+// returned to the bucket when ctx ends first.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens * float64(b.interval))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,98 @@
+package syscmd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Concurrency(t *testing.T) {
+	limiter := NewLimiter().Set("sleep", Limit{Concurrency: 1})
+	cmd := New(context.Background()).Limit(limiter)
+
+	var wg sync.WaitGroup
+	results := make([]*Result, 2)
+	start := time.Now()
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := cmd.ExecuteResult("sleep", "0.3")
+			assert.NoError(t, err)
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+
+	assert.GreaterOrEqual(t, time.Since(start), 600*time.Millisecond)
+	waited := results[0].QueueWait + results[1].QueueWait
+	assert.GreaterOrEqual(t, waited, 250*time.Millisecond)
+	for _, res := range results {
+		assert.Less(t, res.Duration, 550*time.Millisecond, "queue wait is not part of Duration")
+	}
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	limiter := NewLimiter().Default(Limit{Rate: 10, Per: time.Second, Burst: 2})
+	cmd := New(context.Background()).Limit(limiter)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		_, err := cmd.Execute("true")
+		require.NoError(t, err)
+	}
+
+	// two attempts from the burst, two more at 100ms intervals
+	assert.GreaterOrEqual(t, time.Since(start), 180*time.Millisecond)
+}
+
+func TestLimiter_KeysAreIndependent(t *testing.T) {
+	limiter := NewLimiter().Set("sleep", Limit{Concurrency: 1})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		New(context.Background()).Limit(limiter).Execute("sleep", "0.5")
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	res, err := New(context.Background()).Limit(limiter).ExecuteResult("true")
+	require.NoError(t, err)
+	assert.Less(t, res.QueueWait, 100*time.Millisecond)
+	<-done
+}
+
+func TestLimiter_CustomKey(t *testing.T) {
+	limiter := NewLimiter().
+		Key(func(string, []string) string { return "vendor-api" }).
+		Set("vendor-api", Limit{Rate: 1, Per: time.Hour})
+	cmd := New(context.Background()).Limit(limiter)
+
+	_, err := cmd.Execute("true")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = New(ctx).Limit(limiter).Execute("echo")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "rate limit")
+}
+
+func TestLimiter_WaitRespectsContext(t *testing.T) {
+	limiter := NewLimiter().Set("sleep", Limit{Concurrency: 1})
+	go New(context.Background()).Limit(limiter).Execute("sleep", "1")
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	res, err := New(ctx).Limit(limiter).ExecuteResult("sleep", "0")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, res.Attempts)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
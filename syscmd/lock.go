@@ -0,0 +1,98 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// lockPollInterval is how often a blocking Lock retries a held lock
+const lockPollInterval = 50 * time.Millisecond
+
+// fileLock is an advisory lock on a file shared between processes
+type fileLock struct {
+	path string
+	try  bool
+}
+
+// LockError reports a lock held by another process. It matches ErrLocked with errors.Is.
+type LockError struct {
+	Path    string
+	PID     int  // PID recorded by the holder, 0 if unknown
+	Running bool // whether the recorded PID is a running process
+}
+
+func (e *LockError) Error() string {
+	switch {
+	case e.PID == 0:
+		return fmt.Sprintf("%v: %s", ErrLocked, e.Path)
+	case e.Running:
+		return fmt.Sprintf("%v: %s (pid %d)", ErrLocked, e.Path, e.PID)
+	default:
+		return fmt.Sprintf("%v: %s (pid %d is not running, the lock was probably inherited by one of its children)", ErrLocked, e.Path, e.PID)
+	}
+}
+
+func (e *LockError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// acquire takes the lock, waiting for it unless the lock is a try-lock.
+// The returned function releases it.
+func (l *fileLock) acquire(ctx context.Context) (func(), error) {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	for {
+		err := tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLockBusy) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", l.path, err)
+		}
+		if l.try {
+			f.Close()
+			return nil, l.holder()
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("%w: %w", l.holder(), ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// record the holder for diagnostics of waiting processes
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	return func() {
+		f.Truncate(0)
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// holder describes the current holder of the lock
+func (l *fileLock) holder() *LockError {
+	lerr := &LockError{Path: l.path}
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return lerr
+	}
+	if pid, err := strconv.Atoi(string(bytes.TrimSpace(data))); err == nil && pid > 0 {
+		lerr.PID = pid
+		lerr.Running = processRunning(pid)
+	}
+	return lerr
+}
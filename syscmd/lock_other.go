@@ -0,0 +1,22 @@
+//go:build !unix
+
+package syscmd
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockBusy = errors.New("lock busy")
+
+func tryLockFile(*os.File) error {
+	return errors.New("file locks are not supported on this platform")
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
+
+func processRunning(int) bool {
+	return false
+}
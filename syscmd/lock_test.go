@@ -0,0 +1,91 @@
+//go:build unix
+
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock_SerializesExecutions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+	cmd := New(context.Background()).Lock(path)
+
+	done := make(chan error, 2)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := cmd.Execute("sleep", "0.3")
+			done <- err
+		}()
+	}
+	require.NoError(t, <-done)
+	require.NoError(t, <-done)
+
+	assert.GreaterOrEqual(t, time.Since(start), 600*time.Millisecond)
+}
+
+func TestLock_HeldDuringRetries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+	script := "cat " + path + "; exit 1"
+
+	res, err := New(context.Background()).
+		Lock(path).
+		Retry(1, 10*time.Millisecond).
+		ExecuteResult("sh", "-c", script)
+	require.Error(t, err)
+	assert.Equal(t, 2, res.Attempts)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), strings.TrimSpace(res.Output), "lock file records the holder")
+}
+
+func TestTryLock_ReportsHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+	go New(context.Background()).Lock(path).Execute("sleep", "0.5")
+	time.Sleep(150 * time.Millisecond)
+
+	res, err := New(context.Background()).TryLock(path).ExecuteResult("true")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.Equal(t, 0, res.Attempts)
+
+	var lerr *LockError
+	require.True(t, errors.As(err, &lerr))
+	assert.Equal(t, os.Getpid(), lerr.PID)
+	assert.True(t, lerr.Running)
+	assert.Contains(t, err.Error(), "(pid "+strconv.Itoa(os.Getpid())+")")
+}
+
+func TestLock_WaitRespectsContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+	go New(context.Background()).Lock(path).Execute("sleep", "1")
+	time.Sleep(150 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := New(ctx).Lock(path).Execute("true")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestLockError_StaleHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "job.lock")
+	// PIDs are capped well below this value on Linux and BSDs
+	require.NoError(t, os.WriteFile(path, []byte("99999999\n"), 0o644))
+
+	lerr := (&fileLock{path: path}).holder()
+	assert.Equal(t, 99999999, lerr.PID)
+	assert.False(t, lerr.Running)
+	assert.Contains(t, lerr.Error(), "is not running")
+}
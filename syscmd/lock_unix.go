@@ -0,0 +1,24 @@
+//go:build unix
+
+package syscmd
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var errLockBusy = syscall.EWOULDBLOCK
+
+func tryLockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,83 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Logger logs the lifecycle of every execution to l: the start at debug
+// level, success at info, failed attempts that are retried and commands
+// killed on timeout or cancellation at warn, and the final failure at error.
+// Arguments are redacted with RedactArgs and errors are reduced to their
+// ErrorSummary, without the command output. Nothing is logged by default.
+func (c *Process) Logger(l *slog.Logger) *Process {
+	c = c.Clone()
+	c.logger = l
+	return c
+}
+
+type logStateKey struct{}
+
+// logState carries the last attempt of an execution to OnRetry
+type logState struct {
+	attempt  int
+	exitCode int
+}
+
+// logHooks returns the hooks logging to l
+func logHooks(l *slog.Logger) Hooks {
+	cmd := func(e *Execution) slog.Attr {
+		return slog.Group("cmd", slog.String("name", e.Name), slog.Any("args", RedactArgs(e.Args)))
+	}
+
+	return Hooks{
+		OnStart: func(ctx context.Context, e *Execution) context.Context {
+			l.LogAttrs(ctx, slog.LevelDebug, "command started", cmd(e))
+			return context.WithValue(ctx, logStateKey{}, &logState{})
+		},
+		OnAttemptDone: func(ctx context.Context, e *Execution, a *Attempt, res *Result, err error) {
+			if s, ok := ctx.Value(logStateKey{}).(*logState); ok {
+				s.attempt, s.exitCode = a.Number, res.ExitCode
+			}
+			if err == nil || res.ExitCode != -1 {
+				return
+			}
+			reason := ""
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				reason = "timeout"
+			case errors.Is(err, context.Canceled):
+				reason = "canceled"
+			default:
+				return
+			}
+			l.LogAttrs(ctx, slog.LevelWarn, "command killed", cmd(e),
+				slog.String("reason", reason),
+				slog.Int("attempt", a.Number),
+				slog.Duration("elapsed", time.Since(a.Start)))
+		},
+		OnRetry: func(ctx context.Context, e *Execution, err error, delay time.Duration) {
+			attrs := []slog.Attr{cmd(e), slog.Duration("next_delay", delay), slog.String("error", ErrorSummary(err))}
+			if s, ok := ctx.Value(logStateKey{}).(*logState); ok {
+				attrs = append(attrs, slog.Int("attempt", s.attempt), slog.Int("exit_code", s.exitCode))
+			}
+			l.LogAttrs(ctx, slog.LevelWarn, "command attempt failed, retrying", attrs...)
+		},
+		OnFinish: func(ctx context.Context, e *Execution, res *Result, err error) {
+			attrs := []slog.Attr{
+				cmd(e),
+				slog.Int("exit_code", res.ExitCode),
+				slog.Int("attempts", res.Attempts),
+				slog.Duration("duration", res.Duration),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", ErrorSummary(err)))
+				l.LogAttrs(ctx, slog.LevelError, "command failed", attrs...)
+				return
+			}
+			l.LogAttrs(ctx, slog.LevelInfo, "command succeeded", attrs...)
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logRecords decodes the JSON lines written by a slog JSON handler
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var r map[string]any
+		require.NoError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLogger_Success(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(context.Background()).Logger(newTestLogger(&buf)).Execute("echo", "--token=s3cret", "hi")
+	require.NoError(t, err)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "DEBUG", records[0]["level"])
+	assert.Equal(t, "command started", records[0]["msg"])
+	assert.Equal(t, "INFO", records[1]["level"])
+	assert.Equal(t, "command succeeded", records[1]["msg"])
+	assert.Equal(t, float64(0), records[1]["exit_code"])
+
+	cmd := records[1]["cmd"].(map[string]any)
+	assert.Equal(t, "echo", cmd["name"])
+	assert.Equal(t, []any{"--token=" + Redacted, "hi"}, cmd["args"])
+	assert.NotContains(t, buf.String(), "s3cret")
+}
+
+func TestLogger_RetriesAndFailure(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(context.Background()).Logger(newTestLogger(&buf)).Retry(1, 10*time.Millisecond).Execute("false")
+	require.Error(t, err)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 3)
+	assert.Equal(t, "WARN", records[1]["level"])
+	assert.Equal(t, "command attempt failed, retrying", records[1]["msg"])
+	assert.Equal(t, float64(1), records[1]["attempt"])
+	assert.Equal(t, float64(1), records[1]["exit_code"])
+	assert.NotEmpty(t, records[1]["next_delay"])
+
+	assert.Equal(t, "ERROR", records[2]["level"])
+	assert.Equal(t, "command failed", records[2]["msg"])
+	assert.Equal(t, float64(2), records[2]["attempts"])
+	assert.Contains(t, records[2]["error"], "exit status 1")
+}
+
+func TestLogger_OmitsOutput(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(context.Background()).
+		Logger(newTestLogger(&buf)).
+		Retry(1, 10*time.Millisecond).
+		Env("OUT=SECRET_OUTPUT").
+		Execute("sh", "-c", "echo $OUT; exit 4")
+	require.Error(t, err)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 3)
+	assert.Equal(t, "command failed: exit status 4", records[1]["error"])
+	assert.Equal(t, "command failed: exit status 4", records[2]["error"])
+	assert.NotContains(t, buf.String(), "SECRET_OUTPUT")
+}
+
+func TestLogger_Killed(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(context.Background()).Logger(newTestLogger(&buf)).Timeout(50*time.Millisecond).Execute("sleep", "5")
+	require.Error(t, err)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 3)
+	assert.Equal(t, "WARN", records[1]["level"])
+	assert.Equal(t, "command killed", records[1]["msg"])
+	assert.Equal(t, "timeout", records[1]["reason"])
+	assert.Equal(t, "ERROR", records[2]["level"])
+}
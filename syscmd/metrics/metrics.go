@@ -0,0 +1,190 @@
+// Package metrics records Prometheus metrics for syscmd executions.
+//
+//	m, err := metrics.New(prometheus.DefaultRegisterer, metrics.Options{})
+//	...
+//	output, err := m.Instrument(syscmd.New(ctx)).Execute("git", "fetch")
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gtihub.com/sowinskl/go-common/syscmd"
+)
+
+// Outcomes of an execution, used as the outcome label
+const (
+	OutcomeSuccess  = "success"   // the command exited with code 0
+	OutcomeExitCode = "exit_code" // the command exited with a non-zero code
+	OutcomeTimeout  = "timeout"   // the command was killed by the timeout
+	OutcomeCanceled = "canceled"  // the process context was canceled
+	OutcomeNotFound = "not_found" // the executable does not exist
+	OutcomeError    = "error"     // any other failure, such as a policy denial
+)
+
+// OtherBinary replaces binary names beyond the cardinality limit
+const OtherBinary = "other"
+
+// Options configures a Collector
+type Options struct {
+	// Namespace prefixes the metric names. Defaults to "syscmd".
+	Namespace string
+
+	// Binaries lists the binary names reported as such, others are reported
+	// as OtherBinary. When empty, the first MaxBinaries names seen are kept.
+	Binaries []string
+
+	// MaxBinaries bounds the number of distinct binary labels when Binaries
+	// is empty. Defaults to 50.
+	MaxBinaries int
+
+	// DurationBuckets are the buckets of the duration histogram in seconds.
+	// Defaults to 10ms to about 10 minutes.
+	DurationBuckets []float64
+}
+
+// Collector records executions of the processes it instruments
+type Collector struct {
+	executions *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	attempts   *prometheus.HistogramVec
+	inFlight   *prometheus.GaugeVec
+
+	mu          sync.Mutex
+	binaries    map[string]bool
+	fixed       bool
+	maxBinaries int
+}
+
+// New creates a Collector and registers its metrics on reg
+func New(reg prometheus.Registerer, opts Options) (*Collector, error) {
+	if opts.Namespace == "" {
+		opts.Namespace = "syscmd"
+	}
+	if opts.MaxBinaries <= 0 {
+		opts.MaxBinaries = 50
+	}
+	if opts.DurationBuckets == nil {
+		opts.DurationBuckets = prometheus.ExponentialBuckets(0.01, 4, 10)
+	}
+
+	c := &Collector{
+		executions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "executions_total",
+			Help:      "Command executions by binary and outcome.",
+		}, []string{"binary", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "execution_duration_seconds",
+			Help:      "Duration of command executions including retries, excluding limiter waits.",
+			Buckets:   opts.DurationBuckets,
+		}, []string{"binary", "outcome"}),
+		attempts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "execution_attempts",
+			Help:      "Number of times a command was started per execution.",
+			Buckets:   []float64{1, 2, 3, 5, 10},
+		}, []string{"binary"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: opts.Namespace,
+			Name:      "executions_in_flight",
+			Help:      "Command executions currently running.",
+		}, []string{"binary"}),
+		binaries:    make(map[string]bool),
+		maxBinaries: opts.MaxBinaries,
+	}
+	for _, name := range opts.Binaries {
+		c.binaries[normalize(name)] = true
+		c.fixed = true
+	}
+
+	for _, collector := range []prometheus.Collector{c.executions, c.duration, c.attempts, c.inFlight} {
+		if err := reg.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Hooks returns the hooks recording the metrics, see syscmd.Process.Hooks
+func (c *Collector) Hooks() syscmd.Hooks {
+	return syscmd.Hooks{
+		OnStart: func(ctx context.Context, e *syscmd.Execution) context.Context {
+			c.inFlight.WithLabelValues(c.binary(e.Name)).Inc()
+			return ctx
+		},
+		OnFinish: func(_ context.Context, e *syscmd.Execution, res *syscmd.Result, err error) {
+			binary := c.binary(e.Name)
+			outcome := Outcome(res, err)
+			c.inFlight.WithLabelValues(binary).Dec()
+			c.executions.WithLabelValues(binary, outcome).Inc()
+			c.duration.WithLabelValues(binary, outcome).Observe(res.Duration.Seconds())
+			if res.Attempts > 0 {
+				c.attempts.WithLabelValues(binary).Observe(float64(res.Attempts))
+			}
+		},
+	}
+}
+
+// Instrument adds the hooks of the collector to p
+func (c *Collector) Instrument(p *syscmd.Process) *syscmd.Process {
+	return p.Hooks(c.Hooks())
+}
+
+// Outcome classifies the result of an execution
+func Outcome(res *syscmd.Result, err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, context.DeadlineExceeded):
+		return OutcomeTimeout
+	case errors.Is(err, context.Canceled):
+		return OutcomeCanceled
+	case errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist):
+		return OutcomeNotFound
+	case res != nil && res.ExitCode > 0:
+		return OutcomeExitCode
+	default:
+		return OutcomeError
+	}
+}
+
+// binary returns the label for a command name, bounding the label cardinality
+func (c *Collector) binary(name string) string {
+	name = normalize(name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.binaries[name] {
+		return name
+	}
+	if c.fixed || len(c.binaries) >= c.maxBinaries {
+		return OtherBinary
+	}
+	c.binaries[name] = true
+	return name
+}
+
+// normalize reduces a command name to its lower case base name, so /usr/bin/git
+// and git share a label. Names with unexpected characters are reported as
+// OtherBinary.
+func normalize(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(filepath.Base(name)), ".exe")
+	if name == "" || name == "." || name == "/" {
+		return OtherBinary
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("._+-", r)) {
+			return OtherBinary
+		}
+	}
+	return name
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gtihub.com/sowinskl/go-common/syscmd"
+)
+
+func newCollector(t *testing.T, opts Options) (*Collector, *prometheus.Registry) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	c, err := New(reg, opts)
+	require.NoError(t, err)
+	return c, reg
+}
+
+func TestCollector_Outcomes(t *testing.T) {
+	c, _ := newCollector(t, Options{})
+	ctx := context.Background()
+
+	_, err := c.Instrument(syscmd.New(ctx)).Execute("true")
+	require.NoError(t, err)
+	_, err = c.Instrument(syscmd.New(ctx)).Execute("/bin/sh", "-c", "exit 2")
+	require.Error(t, err)
+	_, err = c.Instrument(syscmd.New(ctx)).Timeout(50*time.Millisecond).Execute("sleep", "5")
+	require.Error(t, err)
+	_, err = c.Instrument(syscmd.New(ctx)).Execute("syscmd-no-such-binary")
+	require.Error(t, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.Instrument(syscmd.New(canceled)).Execute("true")
+	require.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.executions.WithLabelValues("true", OutcomeSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.executions.WithLabelValues("sh", OutcomeExitCode)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.executions.WithLabelValues("sleep", OutcomeTimeout)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.executions.WithLabelValues("syscmd-no-such-binary", OutcomeNotFound)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.executions.WithLabelValues("true", OutcomeCanceled)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(c.inFlight.WithLabelValues("sleep")))
+}
+
+func TestCollector_Histograms(t *testing.T) {
+	c, reg := newCollector(t, Options{Namespace: "app"})
+
+	// retrying stops once (retries+1)*delay*2 elapsed, the delay leaves room
+	// for slow process starts
+	_, err := c.Instrument(syscmd.New(context.Background())).Retry(2, 100*time.Millisecond).Execute("false")
+	require.Error(t, err)
+
+	expected := `
+# HELP app_execution_attempts Number of times a command was started per execution.
+# TYPE app_execution_attempts histogram
+app_execution_attempts_bucket{binary="false",le="1"} 0
+app_execution_attempts_bucket{binary="false",le="2"} 0
+app_execution_attempts_bucket{binary="false",le="3"} 1
+app_execution_attempts_bucket{binary="false",le="5"} 1
+app_execution_attempts_bucket{binary="false",le="10"} 1
+app_execution_attempts_bucket{binary="false",le="+Inf"} 1
+app_execution_attempts_sum{binary="false"} 3
+app_execution_attempts_count{binary="false"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "app_execution_attempts"))
+	assert.Equal(t, 1, testutil.CollectAndCount(c.duration, "app_execution_duration_seconds"))
+}
+
+func TestCollector_InFlight(t *testing.T) {
+	c, _ := newCollector(t, Options{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Instrument(syscmd.New(context.Background())).Execute("sleep", "0.3")
+	}()
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(c.inFlight.WithLabelValues("sleep")) == 1
+	}, time.Second, 10*time.Millisecond)
+	<-done
+	assert.Equal(t, 0.0, testutil.ToFloat64(c.inFlight.WithLabelValues("sleep")))
+}
+
+func TestCollector_BinaryCardinality(t *testing.T) {
+	c, _ := newCollector(t, Options{MaxBinaries: 2})
+	assert.Equal(t, "git", c.binary("/usr/bin/git"))
+	assert.Equal(t, "git", c.binary("GIT.EXE"))
+	assert.Equal(t, "curl", c.binary("curl"))
+	assert.Equal(t, OtherBinary, c.binary("wget"))
+	assert.Equal(t, OtherBinary, c.binary("weird name"))
+
+	c, _ = newCollector(t, Options{Binaries: []string{"git"}})
+	assert.Equal(t, "git", c.binary("/opt/git/bin/git"))
+	assert.Equal(t, OtherBinary, c.binary("curl"))
+}
+
+func TestNew_DuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, err := New(reg, Options{})
+	require.NoError(t, err)
+	_, err = New(reg, Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,260 @@
+package syscmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// StripANSI removes ANSI/VT100 escape sequences such as colors and cursor
+// movements from the output
+func (c *Process) StripANSI() *Process {
+	c = c.Clone()
+	c.stripANSI = true
+	return c
+}
+
+// NormalizeNewlines converts CRLF line endings to LF and collapses lines
+// rewritten with carriage returns, such as progress bars, to their last state
+func (c *Process) NormalizeNewlines() *Process {
+	c = c.Clone()
+	c.normalizeNewlines = true
+	return c
+}
+
+// Charset declares the encoding of the output, which is decoded to UTF-8.
+// name is a WHATWG encoding label such as "latin1", "windows-1252",
+// "utf-16le" or "shift_jis"; an unknown name fails the execution.
+func (c *Process) Charset(name string) *Process {
+	c = c.Clone()
+	c.charset = name
+	return c
+}
+
+// MaxOutput limits the output kept in memory to its last n bytes. Zero, the
+// default, keeps all of it.
+func (c *Process) MaxOutput(n int) *Process {
+	c = c.Clone()
+	c.maxOutput = n
+	return c
+}
+
+// lookupCharset returns the encoding for a label
+func lookupCharset(name string) (encoding.Encoding, error) {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q: %w", name, err)
+	}
+	return enc, nil
+}
+
+// outputWriter wraps w with the configured output transformations. Close
+// flushes data held back by the transformations, it does not close w.
+func (c *Process) outputWriter(w io.Writer) (io.WriteCloser, error) {
+	out := nopWriteCloser{w}
+	var closers []io.Closer
+
+	if c.normalizeNewlines {
+		nw := &newlineWriter{w: out}
+		closers = append(closers, nw)
+		out = nopWriteCloser{nw}
+	}
+	if c.stripANSI {
+		out = nopWriteCloser{&ansiWriter{w: out}}
+	}
+	if c.charset != "" {
+		enc, err := lookupCharset(c.charset)
+		if err != nil {
+			return nil, err
+		}
+		tw := transform.NewWriter(out, enc.NewDecoder())
+		closers = append(closers, tw)
+		out = nopWriteCloser{tw}
+	}
+
+	if len(closers) == 0 {
+		return out, nil
+	}
+	// flush the outermost transformation first so its output reaches the inner ones
+	return &chainWriter{Writer: out, closers: closers}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type chainWriter struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *chainWriter) Close() error {
+	var firstErr error
+	for i := len(w.closers) - 1; i >= 0; i-- {
+		if err := w.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ansiState is the position of ansiWriter in an escape sequence
+type ansiState int
+
+const (
+	ansiText         ansiState = iota
+	ansiEscape                 // after ESC
+	ansiIntermediate           // ESC followed by intermediate bytes, waiting for the final byte
+	ansiCSI                    // control sequence, ESC [
+	ansiString                 // OSC, DCS, SOS, PM or APC string, terminated by ST or BEL
+	ansiStringEscape           // ESC inside a string, possibly starting ST
+)
+
+// ansiWriter drops escape sequences, keeping its state between writes so
+// sequences split across writes are removed as well
+type ansiWriter struct {
+	w     io.Writer
+	state ansiState
+	buf   []byte
+}
+
+func (a *ansiWriter) Write(p []byte) (int, error) {
+	a.buf = a.buf[:0]
+	for _, b := range p {
+		switch a.state {
+		case ansiText:
+			if b == 0x1b {
+				a.state = ansiEscape
+			} else {
+				a.buf = append(a.buf, b)
+			}
+		case ansiEscape:
+			switch {
+			case b == '[':
+				a.state = ansiCSI
+			case b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_':
+				a.state = ansiString
+			case b >= 0x20 && b <= 0x2f:
+				a.state = ansiIntermediate
+			default:
+				a.state = ansiText
+			}
+		case ansiIntermediate:
+			if b < 0x20 || b > 0x2f {
+				a.state = ansiText
+			}
+		case ansiCSI:
+			if b >= 0x40 && b <= 0x7e {
+				a.state = ansiText
+			}
+		case ansiString:
+			switch b {
+			case 0x07:
+				a.state = ansiText
+			case 0x1b:
+				a.state = ansiStringEscape
+			}
+		case ansiStringEscape:
+			if b == '\\' {
+				a.state = ansiText
+			} else {
+				a.state = ansiString
+			}
+		}
+	}
+	if len(a.buf) > 0 {
+		if _, err := a.w.Write(a.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// newlineWriter converts CRLF to LF and drops the part of a line overwritten
+// after a lone CR. The current line is held back until its LF or Close.
+type newlineWriter struct {
+	w       io.Writer
+	line    []byte
+	pending bool // a CR was seen, its meaning depends on the next byte
+}
+
+func (n *newlineWriter) Write(p []byte) (int, error) {
+	var out []byte
+	for _, b := range p {
+		if n.pending {
+			n.pending = false
+			if b != '\n' {
+				// the line is being rewritten
+				n.line = n.line[:0]
+			}
+		}
+		switch b {
+		case '\r':
+			n.pending = true
+		case '\n':
+			out = append(append(out, n.line...), '\n')
+			n.line = n.line[:0]
+		default:
+			n.line = append(n.line, b)
+		}
+	}
+	if len(out) > 0 {
+		if _, err := n.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes the last line when it has no line ending
+func (n *newlineWriter) Close() error {
+	if len(n.line) == 0 {
+		return nil
+	}
+	_, err := n.w.Write(bytes.Clone(n.line))
+	n.line = n.line[:0]
+	return err
+}
+
+// captureBuffer collects output, keeping the last max bytes when max is set.
+// It is safe for concurrent use by the stdout and stderr copiers.
+type captureBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	// compact lazily so that dropping the head stays amortized O(1) per byte
+	if b.max > 0 && len(b.buf) > 2*b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns the captured output, starting at a rune boundary when truncated
+func (b *captureBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max <= 0 || len(b.buf) <= b.max {
+		return b.buf
+	}
+	out := b.buf[len(b.buf)-b.max:]
+	for i := 0; i < utf8.UTFMax-1 && len(out) > 0 && !utf8.RuneStart(out[0]); i++ {
+		out = out[1:]
+	}
+	return out
+}
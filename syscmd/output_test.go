@@ -0,0 +1,68 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBytewise writes data one byte at a time to exercise state kept between writes
+func writeBytewise(t *testing.T, proc *Process, data string) string {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := proc.outputWriter(&out)
+	require.NoError(t, err)
+	for i := 0; i < len(data); i++ {
+		_, err := w.Write([]byte{data[i]})
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return out.String()
+}
+
+func TestStripANSI(t *testing.T) {
+	proc := New(context.Background()).StripANSI()
+	tests := map[string]string{
+		"\x1b[1;31mred\x1b[0m text":                   "red text",
+		"\x1b[2K\x1b[1Gclear line":                    "clear line",
+		"\x1b]0;window title\x07after":                "after",
+		"\x1b]8;;https://x.y\x1b\\link\x1b]8;;\x1b\\": "link",
+		"\x1b(Bcharset \x1b=keypad":                   "charset keypad",
+		"plain ünïcode":                               "plain ünïcode",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, writeBytewise(t, proc, in), "%q", in)
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	proc := New(context.Background()).NormalizeNewlines()
+	assert.Equal(t, "a\nb\nc", writeBytewise(t, proc, "a\r\nb\r\nc"))
+	assert.Equal(t, "100%\ndone\n", writeBytewise(t, proc, " 10%\r 50%\r100%\ndone\n"))
+	assert.Equal(t, "last", writeBytewise(t, proc, "first\rlast"))
+	assert.Equal(t, "\n\n", writeBytewise(t, proc, "\r\n\r\n"))
+}
+
+func TestCharset(t *testing.T) {
+	latin1 := New(context.Background()).Charset("latin1")
+	assert.Equal(t, "café", writeBytewise(t, latin1, "caf\xe9"))
+
+	utf16 := New(context.Background()).Charset("utf-16le")
+	assert.Equal(t, "hé\n", writeBytewise(t, utf16, "h\x00\xe9\x00\n\x00"))
+
+	_, err := New(context.Background()).Charset("no-such-charset").Execute("true")
+	assert.ErrorContains(t, err, `unknown charset "no-such-charset"`)
+}
+
+func TestOutputTransformations_Execute(t *testing.T) {
+	res, err := New(context.Background()).
+		Charset("latin1").
+		StripANSI().
+		NormalizeNewlines().
+		ExecuteResult("printf", `\033[32mcaf\351\033[0m\r\n 1/2\r 2/2\r\nend`)
+	require.NoError(t, err)
+	assert.Equal(t, "café\n 2/2\nend", res.Output)
+}
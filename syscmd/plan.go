@@ -0,0 +1,308 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Task is a named command in a Plan
+type Task struct {
+	Name      string
+	Process   *Process
+	Command   string
+	Args      []string
+	DependsOn []string
+
+	// SkipIf, when set and returning true, skips the task. Skipped tasks
+	// satisfy their dependents.
+	SkipIf func(ctx context.Context) bool
+}
+
+// TaskStatus is the outcome of a task in a plan run
+type TaskStatus int
+
+const (
+	TaskPending   TaskStatus = iota // not started
+	TaskSucceeded                   // the command succeeded
+	TaskFailed                      // the command failed
+	TaskSkipped                     // SkipIf returned true
+	TaskBlocked                     // a dependency failed or was blocked
+	TaskCanceled                    // the plan context ended before the task started
+)
+
+func (s TaskStatus) String() string {
+	switch s {
+	case TaskPending:
+		return "pending"
+	case TaskSucceeded:
+		return "succeeded"
+	case TaskFailed:
+		return "failed"
+	case TaskSkipped:
+		return "skipped"
+	case TaskBlocked:
+		return "blocked"
+	case TaskCanceled:
+		return "canceled"
+	default:
+		return fmt.Sprintf("TaskStatus(%d)", int(s))
+	}
+}
+
+// TaskReport describes how a task ran
+type TaskReport struct {
+	Name     string
+	Status   TaskStatus
+	Result   *Result // nil unless the command was executed
+	Err      error
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Report summarizes a plan run. Tasks are listed in the order they were added.
+type Report struct {
+	Tasks    []TaskReport
+	Duration time.Duration
+}
+
+// String renders the report as a table
+func (r *Report) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tSTATUS\tDURATION\tERROR")
+	for _, t := range r.Tasks {
+		errMsg := ""
+		if t.Err != nil {
+			errMsg = t.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Name, t.Status, t.Duration.Round(time.Millisecond), errMsg)
+	}
+	w.Flush()
+	fmt.Fprintf(&b, "total: %s\n", r.Duration.Round(time.Millisecond))
+	return b.String()
+}
+
+// Plan runs tasks respecting their dependencies with bounded parallelism.
+// When a task fails, tasks depending on it are not run; independent tasks
+// continue.
+type Plan struct {
+	tasks       []Task
+	parallelism int
+}
+
+// NewPlan creates an empty plan running up to 4 tasks at a time
+func NewPlan() *Plan {
+	return &Plan{parallelism: 4}
+}
+
+// Add appends a task to the plan
+func (p *Plan) Add(t Task) *Plan {
+	p.tasks = append(p.tasks, t)
+	return p
+}
+
+// Parallelism sets the maximum number of tasks running at the same time
+func (p *Plan) Parallelism(n int) *Plan {
+	p.parallelism = n
+	return p
+}
+
+// Validate checks that task names are unique, dependencies exist and there are no cycles
+func (p *Plan) Validate() error {
+	index := make(map[string]int, len(p.tasks))
+	for i, t := range p.tasks {
+		if t.Name == "" {
+			return fmt.Errorf("invalid plan: task %d has no name", i)
+		}
+		if _, ok := index[t.Name]; ok {
+			return fmt.Errorf("invalid plan: duplicate task %q", t.Name)
+		}
+		if t.Process == nil {
+			return fmt.Errorf("invalid plan: task %q has no process", t.Name)
+		}
+		index[t.Name] = i
+	}
+	for _, t := range p.tasks {
+		for _, dep := range t.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return fmt.Errorf("invalid plan: task %q depends on unknown task %q", t.Name, dep)
+			}
+		}
+	}
+
+	// depth-first search for back edges
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(p.tasks))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		path = append(path, p.tasks[i].Name)
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("invalid plan: dependency cycle %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, dep := range p.tasks[i].DependsOn {
+			if err := visit(index[dep], path); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+	for i := range p.tasks {
+		if err := visit(i, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run executes the plan. The report is returned even when tasks fail; the
+// error joins the errors of all failed tasks.
+func (p *Plan) Run(ctx context.Context) (*Report, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	report := &Report{Tasks: make([]TaskReport, len(p.tasks))}
+	index := make(map[string]int, len(p.tasks))
+	dependents := make([][]int, len(p.tasks))
+	waiting := make([]int, len(p.tasks))
+	for i, t := range p.tasks {
+		index[t.Name] = i
+		report.Tasks[i] = TaskReport{Name: t.Name}
+	}
+	for i, t := range p.tasks {
+		waiting[i] = len(t.DependsOn)
+		for _, dep := range t.DependsOn {
+			dependents[index[dep]] = append(dependents[index[dep]], i)
+		}
+	}
+
+	parallelism := p.parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	var ready []int
+	for i := range p.tasks {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	done := make(chan int)
+	running, finished := 0, 0
+
+	// complete marks a finished task and releases or blocks its dependents
+	var complete func(i int)
+	complete = func(i int) {
+		finished++
+		status := report.Tasks[i].Status
+		for _, d := range dependents[i] {
+			if status != TaskSucceeded && status != TaskSkipped && report.Tasks[d].Status == TaskPending {
+				report.Tasks[d].Status = TaskBlocked
+				report.Tasks[d].Err = fmt.Errorf("dependency %q %s", p.tasks[i].Name, status)
+			}
+			waiting[d]--
+			if waiting[d] == 0 {
+				if report.Tasks[d].Status == TaskBlocked {
+					complete(d)
+				} else {
+					ready = append(ready, d)
+				}
+			}
+		}
+	}
+
+	for finished < len(p.tasks) {
+		for running < parallelism && len(ready) > 0 {
+			i := ready[0]
+			ready = ready[1:]
+			if ctx.Err() != nil {
+				report.Tasks[i].Status = TaskCanceled
+				report.Tasks[i].Err = ctx.Err()
+				complete(i)
+				continue
+			}
+			running++
+			go func(i int) {
+				p.runTask(ctx, &p.tasks[i], &report.Tasks[i])
+				done <- i
+			}(i)
+		}
+		if running == 0 {
+			break
+		}
+		i := <-done
+		running--
+		complete(i)
+	}
+
+	report.Duration = time.Since(start)
+
+	var errs []error
+	for _, t := range report.Tasks {
+		if t.Status == TaskFailed {
+			errs = append(errs, fmt.Errorf("task %q: %w", t.Name, t.Err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return report, err
+	}
+	if err := ctx.Err(); err != nil {
+		return report, fmt.Errorf("plan canceled: %w", err)
+	}
+	return report, nil
+}
+
+func (p *Plan) runTask(ctx context.Context, t *Task, r *TaskReport) {
+	r.Start = time.Now()
+	defer func() { r.Duration = time.Since(r.Start) }()
+
+	if t.SkipIf != nil && t.SkipIf(ctx) {
+		r.Status = TaskSkipped
+		return
+	}
+
+	proc, cancel := t.Process.under(ctx)
+	defer cancel()
+
+	r.Result, r.Err = proc.ExecuteResult(t.Command, t.Args...)
+	if r.Err != nil {
+		r.Status = TaskFailed
+	} else {
+		r.Status = TaskSucceeded
+	}
+}
+
+// DOT renders the dependency graph in Graphviz DOT format. Edges point from
+// a dependency to the tasks depending on it.
+func (p *Plan) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph plan {\n")
+	for _, t := range p.tasks {
+		fmt.Fprintf(&b, "\t%q [label=%q];\n", t.Name, t.Name+"\n"+strings.Join(append([]string{t.Command}, t.Args...), " "))
+	}
+	for _, t := range p.tasks {
+		deps := append([]string(nil), t.DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", dep, t.Name)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan_RunsInDependencyOrder(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "log")
+	proc := New(context.Background())
+	step := func(name string, deps ...string) Task {
+		return Task{Name: name, Process: proc, Command: "sh", Args: []string{"-c", "echo " + name + " >> " + log}, DependsOn: deps}
+	}
+
+	report, err := NewPlan().
+		Add(step("deploy", "build", "migrate")).
+		Add(step("build", "fetch")).
+		Add(step("migrate", "fetch")).
+		Add(step("fetch")).
+		Run(context.Background())
+	require.NoError(t, err)
+
+	for _, task := range report.Tasks {
+		assert.Equal(t, TaskSucceeded, task.Status, task.Name)
+		assert.NotNil(t, task.Result)
+	}
+	assert.Equal(t, "deploy", report.Tasks[0].Name, "report keeps declaration order")
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	lines := strings.Fields(string(data))
+	require.Len(t, lines, 4)
+	assert.Equal(t, "fetch", lines[0])
+	assert.Equal(t, "deploy", lines[3])
+}
+
+func TestPlan_BoundedParallelism(t *testing.T) {
+	proc := New(context.Background())
+	plan := NewPlan().Parallelism(2)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		plan.Add(Task{Name: name, Process: proc, Command: "sleep", Args: []string{"0.2"}})
+	}
+
+	start := time.Now()
+	_, err := plan.Run(context.Background())
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 750*time.Millisecond)
+}
+
+func TestPlan_FailureBlocksDependents(t *testing.T) {
+	proc := New(context.Background())
+	report, err := NewPlan().
+		Add(Task{Name: "broken", Process: proc, Command: "false"}).
+		Add(Task{Name: "child", Process: proc, Command: "true", DependsOn: []string{"broken"}}).
+		Add(Task{Name: "grandchild", Process: proc, Command: "true", DependsOn: []string{"child"}}).
+		Add(Task{Name: "independent", Process: proc, Command: "true"}).
+		Run(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `task "broken"`)
+
+	statuses := map[string]TaskStatus{}
+	for _, task := range report.Tasks {
+		statuses[task.Name] = task.Status
+	}
+	assert.Equal(t, map[string]TaskStatus{
+		"broken":      TaskFailed,
+		"child":       TaskBlocked,
+		"grandchild":  TaskBlocked,
+		"independent": TaskSucceeded,
+	}, statuses)
+	assert.Contains(t, report.String(), `dependency "broken" failed`)
+}
+
+func TestPlan_SkipIf(t *testing.T) {
+	proc := New(context.Background())
+	report, err := NewPlan().
+		Add(Task{Name: "install", Process: proc, Command: "false", SkipIf: func(context.Context) bool { return true }}).
+		Add(Task{Name: "configure", Process: proc, Command: "true", DependsOn: []string{"install"}}).
+		Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, TaskSkipped, report.Tasks[0].Status)
+	assert.Nil(t, report.Tasks[0].Result)
+	assert.Equal(t, TaskSucceeded, report.Tasks[1].Status)
+}
+
+func TestPlan_Cancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	proc := New(context.Background())
+	report, err := NewPlan().
+		Add(Task{Name: "slow", Process: proc, Command: "sleep", Args: []string{"5"}}).
+		Add(Task{Name: "after", Process: proc, Command: "true", DependsOn: []string{"slow"}}).
+		Run(ctx)
+	require.Error(t, err)
+
+	assert.Equal(t, TaskFailed, report.Tasks[0].Status)
+	assert.Equal(t, TaskBlocked, report.Tasks[1].Status)
+	assert.Less(t, report.Duration, 2*time.Second)
+}
+
+func TestPlan_Validate(t *testing.T) {
+	proc := New(context.Background())
+
+	err := NewPlan().
+		Add(Task{Name: "a", Process: proc, Command: "true", DependsOn: []string{"b"}}).
+		Add(Task{Name: "b", Process: proc, Command: "true", DependsOn: []string{"a"}}).
+		Validate()
+	assert.ErrorContains(t, err, "cycle a -> b -> a")
+
+	err = NewPlan().Add(Task{Name: "a", Process: proc, DependsOn: []string{"missing"}}).Validate()
+	assert.ErrorContains(t, err, `unknown task "missing"`)
+
+	err = NewPlan().Add(Task{Name: "a", Process: proc}).Add(Task{Name: "a", Process: proc}).Validate()
+	assert.ErrorContains(t, err, `duplicate task "a"`)
+
+	_, err = NewPlan().Add(Task{Name: "a"}).Run(context.Background())
+	assert.ErrorContains(t, err, "no process")
+}
+
+func TestPlan_DOT(t *testing.T) {
+	proc := New(context.Background())
+	dot := NewPlan().
+		Add(Task{Name: "fetch", Process: proc, Command: "git", Args: []string{"fetch"}}).
+		Add(Task{Name: "build", Process: proc, Command: "make", DependsOn: []string{"fetch"}}).
+		DOT()
+
+	assert.Equal(t, `digraph plan {
+	"fetch" [label="fetch\ngit fetch"];
+	"build" [label="build\nmake"];
+	"fetch" -> "build";
+}
+`, dot)
+}
+
+func TestPlan_KeepsProcessContextValues(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := WithRequestID(WithActor(context.Background(), "alice"), "req-1")
+	proc := New(ctx).Audit(NewAuditLog(&buf, AuditOptions{}))
+
+	_, err := NewPlan().
+		Add(Task{Name: "hello", Process: proc, Command: "true"}).
+		Run(context.Background())
+	require.NoError(t, err)
+
+	entries := readAuditEntries(t, buf.Bytes())
+	require.Len(t, entries, 1)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Equal(t, "req-1", entries[0].RequestID)
+}
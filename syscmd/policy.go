@@ -0,0 +1,249 @@
+package syscmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy restricts which binaries may be executed and with which arguments.
+// A command is allowed when at least one rule accepts it.
+type Policy struct {
+	// Rules lists the allowed commands.
+	Rules []Rule `json:"rules" yaml:"rules"`
+
+	// DenyFlags lists flags rejected for every command, whatever rule matched.
+	DenyFlags []string `json:"deny_flags,omitempty" yaml:"deny_flags,omitempty"`
+
+	once     sync.Once
+	compiled []compiledRule
+	err      error
+}
+
+// Rule allows a single binary with constrained arguments and environment.
+type Rule struct {
+	// Name identifies the rule in denial errors. Defaults to the binary.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Binary is an absolute path or a bare name. An absolute path matches the
+	// resolved executable; a bare name only matches commands looked up in PATH.
+	Binary string `json:"binary" yaml:"binary"`
+
+	// Args are regular expressions; every argument must fully match at least one.
+	// An empty list allows any arguments.
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+
+	// DenyFlags lists flags that may not be passed, either alone or as
+	// --flag=value. Single-letter flags are also found within clusters such as
+	// -rf and with attached values such as -ofile. Arguments after -- are not
+	// flags.
+	DenyFlags []string `json:"deny_flags,omitempty" yaml:"deny_flags,omitempty"`
+
+	// Env lists the variable names (path.Match patterns) that may be set with
+	// Process.Env. Nil allows any variable, an empty list allows none.
+	Env []string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	args []*regexp.Regexp
+}
+
+// PolicyError describes why a command was rejected. It matches ErrPolicyDenied with errors.Is.
+type PolicyError struct {
+	Rule    string
+	Command string
+	Reason  string
+}
+
+func (e *PolicyError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%v: %s: %s", ErrPolicyDenied, e.Command, e.Reason)
+	}
+	return fmt.Sprintf("%v: %s: %s (rule %q)", ErrPolicyDenied, e.Command, e.Reason, e.Rule)
+}
+
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPolicyDenied
+}
+
+var globalPolicy atomic.Pointer[Policy]
+
+// SetPolicy installs a policy enforced for every Process. Passing nil removes it.
+func SetPolicy(p *Policy) {
+	globalPolicy.Store(p)
+}
+
+// LoadPolicy reads a policy from a YAML or JSON file
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy decodes a YAML or JSON policy and validates it. Unknown fields are rejected.
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks that every rule names a binary and has valid argument patterns
+func (p *Policy) Validate() error {
+	p.once.Do(p.compile)
+	return p.err
+}
+
+func (p *Policy) compile() {
+	for i, r := range p.Rules {
+		if r.Binary == "" {
+			p.err = fmt.Errorf("invalid policy: rule %d has no binary", i)
+			return
+		}
+		if r.Name == "" {
+			r.Name = r.Binary
+		}
+		cr := compiledRule{Rule: r}
+		for _, expr := range r.Args {
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				p.err = fmt.Errorf("invalid policy: rule %q: %w", r.Name, err)
+				return
+			}
+			cr.args = append(cr.args, re)
+		}
+		p.compiled = append(p.compiled, cr)
+	}
+}
+
+// Check reports whether the command may run with the given arguments and
+// extra environment. It returns a *PolicyError on violation.
+func (p *Policy) Check(name string, args []string, env []string) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	resolved := name
+	if lp, err := exec.LookPath(name); err == nil {
+		resolved = lp
+	}
+	if filepath.IsAbs(resolved) {
+		resolved = filepath.Clean(resolved)
+	}
+
+	var denied *PolicyError
+	for _, r := range p.compiled {
+		if !r.matchBinary(name, resolved) {
+			continue
+		}
+		reason := r.check(args, env, p.DenyFlags)
+		if reason == "" {
+			return nil
+		}
+		if denied == nil {
+			denied = &PolicyError{Rule: r.Name, Command: name, Reason: reason}
+		}
+	}
+	if denied != nil {
+		return denied
+	}
+	return &PolicyError{Command: name, Reason: fmt.Sprintf("binary %q is not allowed", resolved)}
+}
+
+func (r *compiledRule) matchBinary(name, resolved string) bool {
+	if filepath.IsAbs(r.Binary) {
+		return filepath.Clean(r.Binary) == resolved
+	}
+	return !strings.ContainsRune(name, filepath.Separator) && name == r.Binary
+}
+
+func (r *compiledRule) check(args, env, denyFlags []string) string {
+	flags := true
+	for _, arg := range args {
+		if arg == "--" {
+			flags = false
+		} else if flag, ok := matchFlag(arg, denyFlags, r.DenyFlags); ok && flags {
+			return fmt.Sprintf("flag %q is denied", flag)
+		}
+		if len(r.args) > 0 && !matchAny(arg, r.args) {
+			return fmt.Sprintf("argument %q does not match any allowed pattern", arg)
+		}
+	}
+	if r.Env != nil {
+		for _, kv := range env {
+			key, _, _ := strings.Cut(kv, "=")
+			if !matchName(key, r.Env) {
+				return fmt.Sprintf("environment variable %q is not allowed", key)
+			}
+		}
+	}
+	return ""
+}
+
+// matchFlag returns the flag of lists that arg passes. A single-dash arg is
+// also read as a cluster of single-letter flags, the last possibly followed by
+// a value, so every letter of it is checked.
+func matchFlag(arg string, lists ...[]string) (string, bool) {
+	cluster := len(arg) > 1 && arg[0] == '-' && arg[1] != '-'
+	for _, flags := range lists {
+		for _, flag := range flags {
+			if arg == flag || strings.HasPrefix(arg, flag+"=") {
+				return flag, true
+			}
+			short := len(flag) == 2 && flag[0] == '-' && flag[1] != '-'
+			if cluster && short && strings.IndexByte(arg[1:], flag[1]) >= 0 {
+				return flag, true
+			}
+		}
+	}
+	return "", false
+}
+
+func matchAny(arg string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchName(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPolicy enforces the global policy and the policy attached to the process
+func (c *Process) checkPolicy(name string, args []string) error {
+	for _, p := range []*Policy{globalPolicy.Load(), c.policy} {
+		if p == nil {
+			continue
+		}
+		if err := p.Check(name, args, c.env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_AllowsMatchingCommand(t *testing.T) {
+	p := &Policy{Rules: []Rule{{Binary: "echo", Args: []string{"hello", "world"}}}}
+
+	output, err := New(context.Background()).Policy(p).Execute("echo", "hello", "world")
+	require.NoError(t, err)
+	assert.Contains(t, output, "hello world")
+}
+
+func TestPolicy_DeniesUnknownBinary(t *testing.T) {
+	p := &Policy{Rules: []Rule{{Binary: "echo"}}}
+
+	_, err := New(context.Background()).Policy(p).Execute("true")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+	assert.Contains(t, err.Error(), "is not allowed")
+}
+
+func TestPolicy_AbsolutePath(t *testing.T) {
+	echo, err := exec.LookPath("echo")
+	require.NoError(t, err)
+	p := &Policy{Rules: []Rule{{Binary: echo}}}
+
+	assert.NoError(t, p.Check("echo", nil, nil))
+	assert.NoError(t, p.Check(echo, nil, nil))
+
+	// a bare name rule does not match an explicit path
+	p = &Policy{Rules: []Rule{{Binary: "echo"}}}
+	assert.ErrorIs(t, p.Check(echo, nil, nil), ErrPolicyDenied)
+}
+
+func TestPolicy_ArgumentPatterns(t *testing.T) {
+	p := &Policy{Rules: []Rule{{
+		Name:   "systemctl",
+		Binary: "systemctl",
+		Args:   []string{"restart|status", `[a-z0-9@.-]+\.service`},
+	}}}
+
+	assert.NoError(t, p.Check("systemctl", []string{"restart", "nginx.service"}, nil))
+
+	err := p.Check("systemctl", []string{"stop", "nginx.service"}, nil)
+	var perr *PolicyError
+	require.True(t, errors.As(err, &perr))
+	assert.Equal(t, "systemctl", perr.Rule)
+	assert.Contains(t, perr.Reason, `"stop"`)
+	assert.Contains(t, err.Error(), `(rule "systemctl")`)
+}
+
+func TestPolicy_DenyFlags(t *testing.T) {
+	p := &Policy{
+		Rules:     []Rule{{Binary: "rm", DenyFlags: []string{"-r"}}},
+		DenyFlags: []string{"--no-preserve-root"},
+	}
+
+	assert.NoError(t, p.Check("rm", []string{"file"}, nil))
+	assert.ErrorIs(t, p.Check("rm", []string{"-r", "dir"}, nil), ErrPolicyDenied)
+	assert.ErrorIs(t, p.Check("rm", []string{"--no-preserve-root=yes"}, nil), ErrPolicyDenied)
+	assert.ErrorIs(t, p.Check("rm", []string{"-rf", "dir"}, nil), ErrPolicyDenied)
+	assert.ErrorIs(t, p.Check("rm", []string{"-fr", "dir"}, nil), ErrPolicyDenied)
+	assert.NoError(t, p.Check("rm", []string{"-f", "--", "-r"}, nil), "operands after -- are not flags")
+}
+
+func TestPolicy_DenyFlagsAttachedValue(t *testing.T) {
+	p := &Policy{Rules: []Rule{{Binary: "sort", DenyFlags: []string{"-o"}}}}
+
+	assert.NoError(t, p.Check("sort", []string{"-n", "file"}, nil))
+	assert.ErrorIs(t, p.Check("sort", []string{"-o", "out", "file"}, nil), ErrPolicyDenied)
+	assert.ErrorIs(t, p.Check("sort", []string{"-oout", "file"}, nil), ErrPolicyDenied)
+	assert.ErrorIs(t, p.Check("sort", []string{"-no=out", "file"}, nil), ErrPolicyDenied)
+	assert.NoError(t, p.Check("sort", []string{"--", "-oout"}, nil))
+}
+
+func TestPolicy_EnvRestrictions(t *testing.T) {
+	p := &Policy{Rules: []Rule{{Binary: "env", Env: []string{"LANG", "LC_*"}}}}
+
+	assert.NoError(t, p.Check("env", nil, []string{"LANG=C", "LC_ALL=C"}))
+	err := p.Check("env", nil, []string{"LD_PRELOAD=/tmp/x.so"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "LD_PRELOAD")
+
+	_, err = New(context.Background()).Policy(p).Env("LD_PRELOAD=/tmp/x.so").Execute("env")
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+}
+
+func TestPolicy_AnyMatchingRuleAllows(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Name: "read", Binary: "git", Args: []string{"status|log"}},
+		{Name: "fetch", Binary: "git", Args: []string{"fetch", "origin"}},
+	}}
+
+	assert.NoError(t, p.Check("git", []string{"fetch", "origin"}, nil))
+
+	var perr *PolicyError
+	require.True(t, errors.As(p.Check("git", []string{"push"}, nil), &perr))
+	assert.Equal(t, "read", perr.Rule)
+}
+
+func TestSetPolicy(t *testing.T) {
+	SetPolicy(&Policy{Rules: []Rule{{Binary: "echo"}}})
+	defer SetPolicy(nil)
+
+	_, err := New(context.Background()).Execute("echo", "ok")
+	assert.NoError(t, err)
+
+	// a process policy cannot widen the global one
+	p := &Policy{Rules: []Rule{{Binary: "true"}}}
+	_, err = New(context.Background()).Policy(p).Execute("true")
+	assert.ErrorIs(t, err, ErrPolicyDenied)
+}
+
+func TestParsePolicy(t *testing.T) {
+	yamlPolicy := `
+rules:
+  - name: restart
+    binary: systemctl
+    args: ["restart", '[a-z]+\.service']
+    env: []
+deny_flags: ["--force"]
+`
+	p, err := ParsePolicy([]byte(yamlPolicy))
+	require.NoError(t, err)
+	require.Len(t, p.Rules, 1)
+	assert.Equal(t, []string{"--force"}, p.DenyFlags)
+	assert.NoError(t, p.Check("systemctl", []string{"restart", "nginx.service"}, nil))
+	assert.Error(t, p.Check("systemctl", []string{"restart"}, []string{"FOO=bar"}))
+
+	jsonPolicy := `{"rules": [{"binary": "/usr/bin/uname", "args": ["-[a-z]"]}]}`
+	p, err = ParsePolicy([]byte(jsonPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/uname", p.Rules[0].Binary)
+
+	_, err = ParsePolicy([]byte(`{"rules": [{"binary": "ls", "args": ["("]}]}`))
+	assert.Error(t, err)
+
+	_, err = ParsePolicy([]byte(`{"rules": [{"args": ["-l"]}]}`))
+	assert.Error(t, err)
+
+	_, err = ParsePolicy([]byte(`{"rules": [{"binary": "ls", "unknown": true}]}`))
+	assert.Error(t, err)
+}
+
+func TestLoadPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"rules": [{"binary": "echo"}]}`), 0o600))
+
+	p, err := LoadPolicy(file)
+	require.NoError(t, err)
+	assert.NoError(t, p.Check("echo", nil, nil))
+
+	_, err = LoadPolicy(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package syscmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Spec describes a command line together with its environment and working directory
+type Spec struct {
+	Name string
+	Args []string
+	Env  []string // variables set on top of the inherited environment
+	Dir  string
+}
+
+// Spec returns the command line the process would run for name and args
+func (c *Process) Spec(name string, args ...string) Spec {
+	return Spec{Name: name, Args: args, Env: c.env, Dir: c.dir}
+}
+
+// Argv returns the name followed by the arguments
+func (s Spec) Argv() []string {
+	return append([]string{s.Name}, s.Args...)
+}
+
+// String renders the command as a copy-pasteable POSIX shell line, for example
+//
+//	cd /srv/app && MODE=prod ./deploy --message 'it'\''s done'
+func (s Spec) String() string {
+	var b strings.Builder
+	if s.Dir != "" {
+		b.WriteString("cd ")
+		b.WriteString(quoteArg(s.Dir))
+		b.WriteString(" && ")
+	}
+	for _, kv := range s.Env {
+		key, value, ok := strings.Cut(kv, "=")
+		if ok && isEnvName(key) {
+			b.WriteString(key + "=" + quoteArg(value))
+		} else {
+			// not expressible as an assignment, pass it through env(1)
+			b.WriteString("env " + quoteArg(kv))
+		}
+		b.WriteByte(' ')
+	}
+	b.WriteString(Quote(s.Argv()...))
+	return b.String()
+}
+
+// Quote renders args as a POSIX shell word list. Arguments are single-quoted
+// unless they only contain characters that are never special to the shell.
+func Quote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func quoteArg(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if strings.IndexFunc(arg, func(r rune) bool { return !isSafeRune(r) }) < 0 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func isSafeRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_@%+=:,./-", r)
+}
+
+func isEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Split parses a shell-like command line into argv without invoking a shell.
+// It supports whitespace separation, single quotes, double quotes with
+// backslash escapes, backslash escapes, line continuations and comments.
+// Expansions, substitutions, pipes, redirects and command separators,
+// including unquoted newlines other than a trailing one, are rejected with
+// ErrUnsafeSyntax instead of being passed through literally; quote them to use
+// them as plain text. Globs and ~ are never expanded.
+func Split(line string) ([]string, error) {
+	var (
+		args    []string
+		word    strings.Builder
+		inWord  bool
+		runes   = []rune(line)
+		unsafef = func(i int) error {
+			return fmt.Errorf("%w: %q at offset %d, quote it to use it literally", ErrUnsafeSyntax, runes[i], i)
+		}
+	)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n' && strings.TrimSpace(string(runes[i:])) != "":
+			// the shell would run what follows as another command
+			return nil, unsafef(i)
+
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+		case r == '#' && !inWord:
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, errors.New("syscmd: trailing backslash")
+			}
+			i++
+			if runes[i] != '\n' { // line continuation
+				word.WriteRune(runes[i])
+				inWord = true
+			}
+
+		case r == '\'':
+			end := strings.IndexRune(string(runes[i+1:]), '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("syscmd: unterminated single quote at offset %d", i)
+			}
+			quoted := []rune(string(runes[i+1:])[:end])
+			word.WriteString(string(quoted))
+			i += len(quoted) + 1
+			inWord = true
+
+		case r == '"':
+			start := i
+			inWord = true
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, fmt.Errorf("syscmd: unterminated double quote at offset %d", start)
+				}
+				c := runes[i]
+				if c == '"' {
+					break
+				}
+				if c == '$' || c == '`' {
+					return nil, unsafef(i)
+				}
+				if c == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+					i++
+					if runes[i] != '\n' {
+						word.WriteRune(runes[i])
+					}
+					continue
+				}
+				word.WriteRune(c)
+			}
+
+		case strings.ContainsRune("|&;<>()$`", r):
+			return nil, unsafef(i)
+
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,122 @@
+package syscmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ls", "-la", "/tmp"}, "ls -la /tmp"},
+		{[]string{""}, "''"},
+		{[]string{"hello world"}, "'hello world'"},
+		{[]string{"it's"}, `'it'\''s'`},
+		{[]string{"$HOME", "`id`", "a;b", "*.go"}, `'$HOME' '` + "`id`" + `' 'a;b' '*.go'`},
+		{[]string{"--opt=a,b:c@d%e+f"}, "--opt=a,b:c@d%e+f"},
+		{[]string{"line\nbreak", "tab\there"}, "'line\nbreak' 'tab\there'"},
+		{[]string{"~", "!", "#x"}, `'~' '!' '#x'`},
+		{[]string{"naïve"}, "'naïve'"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Quote(tt.args...), "%q", tt.args)
+	}
+}
+
+func TestSpec_String(t *testing.T) {
+	spec := Spec{
+		Name: "./deploy",
+		Args: []string{"--message", "it's done"},
+		Env:  []string{"MODE=prod", "GREETING=hello world", "weird-name=x"},
+		Dir:  "/srv/my app",
+	}
+	assert.Equal(t, `cd '/srv/my app' && MODE=prod GREETING='hello world' env weird-name=x ./deploy --message 'it'\''s done'`, spec.String())
+
+	assert.Equal(t, "true", Spec{Name: "true"}.String())
+
+	proc := New(context.Background()).Env("A=1").Dir("/tmp")
+	assert.Equal(t, "cd /tmp && A=1 echo 'a b'", proc.Spec("echo", "a b").String())
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"ls -la /tmp", []string{"ls", "-la", "/tmp"}},
+		{"  spaced\t\targs  ", []string{"spaced", "args"}},
+		{`echo 'single quoted $HOME'`, []string{"echo", "single quoted $HOME"}},
+		{`echo "double \"quoted\" \\ \$HOME"`, []string{"echo", `double "quoted" \ $HOME`}},
+		{`echo "keep \n and \t"`, []string{"echo", `keep \n and \t`}},
+		{`echo a\ b c\'d`, []string{"echo", "a b", "c'd"}},
+		{`echo ''`, []string{"echo", ""}},
+		{`echo ""`, []string{"echo", ""}},
+		{`echo pre'mid'"post"`, []string{"echo", "premidpost"}},
+		{`'it'\''s'`, []string{"it's"}},
+		{"first \\\n  second", []string{"first", "second"}},
+		{"cmd # a comment", []string{"cmd"}},
+		{"cmd a#b", []string{"cmd", "a#b"}},
+		{"cmd # comment\n", []string{"cmd"}},
+		{"trailing newline\n", []string{"trailing", "newline"}},
+		{"'quoted\nnewline'", []string{"quoted\nnewline"}},
+		{"glob *.go ~/x", []string{"glob", "*.go", "~/x"}},
+		{`quoted 'a|b' "c;d" 'e>f'`, []string{"quoted", "a|b", "c;d", "e>f"}},
+		{`unicode 'zażółć' "gęślą"`, []string{"unicode", "zażółć", "gęślą"}},
+	}
+
+	for _, tt := range tests {
+		got, err := Split(tt.line)
+		require.NoError(t, err, "%q", tt.line)
+		assert.Equal(t, tt.want, got, "%q", tt.line)
+	}
+}
+
+func TestSplit_Errors(t *testing.T) {
+	unsafe := []string{
+		"echo $HOME",
+		"echo `id`",
+		`echo "$(id)"`,
+		"echo \"`id`\"",
+		"a | b",
+		"a && b",
+		"a; b",
+		"a > out",
+		"a < in",
+		"(subshell)",
+		"a\nb",
+		"cmd # comment\nnext",
+	}
+	for _, line := range unsafe {
+		_, err := Split(line)
+		assert.ErrorIs(t, err, ErrUnsafeSyntax, "%q", line)
+	}
+
+	for _, line := range []string{`echo 'open`, `echo "open`, `echo trailing\`} {
+		_, err := Split(line)
+		assert.Error(t, err, "%q", line)
+		assert.NotErrorIs(t, err, ErrUnsafeSyntax)
+	}
+}
+
+func TestQuoteSplit_RoundTrip(t *testing.T) {
+	cases := [][]string{
+		{"echo", "hello"},
+		{"printf", "%s\n", "it's \"quoted\""},
+		{"sh", "-c", "echo $1 | tr a-z A-Z; exit 0", "x"},
+		{"", "  ", "\t", "\\", "'", "''", `"`},
+		{"emoji", "🚀 launch", "naïve café"},
+	}
+	for _, args := range cases {
+		got, err := Split(Quote(args...))
+		require.NoError(t, err, "%q", args)
+		assert.Equal(t, args, got)
+	}
+}
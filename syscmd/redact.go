@@ -0,0 +1,108 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Redacted replaces secret values in redacted arguments
+const Redacted = "[REDACTED]"
+
+var secretName = regexp.MustCompile(`(?i)(pass(word|wd)?|secret|token|api[-_]?key|private[-_]?key|credential|authorization)`)
+
+// RedactArgs returns a copy of args with likely secrets masked. It masks the
+// values of secret-looking flags (--password x, --token=x), KEY=VALUE
+// arguments with a secret-looking key and passwords embedded in URLs.
+func RedactArgs(args []string) []string {
+	out := make([]string, len(args))
+	maskNext := false
+	for i, arg := range args {
+		switch {
+		case maskNext:
+			out[i] = Redacted
+			maskNext = false
+		case strings.HasPrefix(arg, "-"):
+			name, _, hasValue := strings.Cut(arg, "=")
+			if !secretName.MatchString(name) {
+				out[i] = arg
+			} else if hasValue {
+				out[i] = name + "=" + Redacted
+			} else {
+				out[i] = arg
+				maskNext = true
+			}
+		default:
+			out[i] = redactValue(arg)
+		}
+	}
+	return out
+}
+
+func redactValue(arg string) string {
+	if key, _, ok := strings.Cut(arg, "="); ok && !strings.Contains(key, "://") && secretName.MatchString(key) {
+		return key + "=" + Redacted
+	}
+	if strings.Contains(arg, "://") {
+		if u, err := url.Parse(arg); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+				return u.String()
+			}
+		}
+	}
+	return arg
+}
+
+// maxErrorSummary bounds the length of an ErrorSummary
+const maxErrorSummary = 256
+
+// summarized are the errors reported by their message alone
+var summarized = []error{
+	ErrPolicyDenied, ErrCircuitOpen, ErrLocked, ErrUnsafeSyntax,
+	ErrSandboxUnavailable, ErrHardeningUnavailable, ErrSeccompViolation, ErrShutdown,
+}
+
+// ErrorSummary describes err without the command output and argument values
+// its message may carry, for logs, audit entries and traces. Known errors are
+// reduced to their class, others are cut before the output and truncated.
+func ErrorSummary(err error) string {
+	if err == nil {
+		return ""
+	}
+	var policyErr *PolicyError
+	if errors.As(err, &policyErr) && policyErr.Rule != "" {
+		return fmt.Sprintf("%v (rule %q)", ErrPolicyDenied, policyErr.Rule)
+	}
+	for _, known := range summarized {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "command timed out"
+	case errors.Is(err, context.Canceled):
+		return "command canceled"
+	case errors.Is(err, exec.ErrNotFound):
+		return "executable not found"
+	case errors.As(err, &exitErr):
+		return "command failed: " + exitErr.Error()
+	}
+
+	msg, _, _ := strings.Cut(err.Error(), ", output: ")
+	if len(msg) > maxErrorSummary {
+		cut := maxErrorSummary
+		for cut > 0 && !utf8.RuneStart(msg[cut]) {
+			cut--
+		}
+		msg = msg[:cut] + "..."
+	}
+	return msg
+}
@@ -0,0 +1,56 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"ls", "-la"}, []string{"ls", "-la"}},
+		{[]string{"--password", "hunter2", "x"}, []string{"--password", Redacted, "x"}},
+		{[]string{"--api-key=abc"}, []string{"--api-key=" + Redacted}},
+		{[]string{"DB_PASSWORD=abc", "MODE=fast"}, []string{"DB_PASSWORD=" + Redacted, "MODE=fast"}},
+		{[]string{"postgres://user:pw@db/app"}, []string{"postgres://user:REDACTED@db/app"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, RedactArgs(tt.args))
+	}
+}
+
+func TestErrorSummary(t *testing.T) {
+	_, exitErr := New(context.Background()).Execute("sh", "-c", "echo SECRET_OUTPUT; exit 2")
+	_, timeoutErr := New(context.Background()).Timeout(10*time.Millisecond).Execute("sh", "-c", "echo SECRET_OUTPUT; sleep 1")
+	_, notFoundErr := New(context.Background()).Execute("no-such-binary-xyz")
+	policyErr := &PolicyError{Rule: "no-rm", Command: "rm", Reason: `argument "SECRET_ARG" denied`}
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{exitErr, "command failed: exit status 2"},
+		{timeoutErr, "command timed out"},
+		{notFoundErr, "executable not found"},
+		{policyErr, `syscmd: command denied by policy (rule "no-rm")`},
+		{fmt.Errorf("wrapped: %w", ErrCircuitOpen), "syscmd: circuit open"},
+		{errors.New("command failed: dry run exit code 1, output: SECRET_OUTPUT"), "command failed: dry run exit code 1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ErrorSummary(tt.err))
+	}
+
+	long := ErrorSummary(errors.New(strings.Repeat("é", 200)))
+	assert.LessOrEqual(t, len(long), maxErrorSummary+len("..."))
+	assert.True(t, strings.HasSuffix(long, "é..."))
+}
@@ -0,0 +1,125 @@
+package syscmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SandboxOptions configures the isolation of a sandboxed command
+type SandboxOptions struct {
+	// ReadOnly lists absolute host paths made read-only inside the sandbox,
+	// paths under /tmp are mounted on the private tmpfs
+	ReadOnly []string
+
+	// Network keeps the host network. By default the command gets a network
+	// namespace with no interfaces besides a down loopback.
+	Network bool
+}
+
+// Sandbox runs the command in new mount, PID, network, IPC and UTS
+// namespaces, with a private tmpfs on /tmp and the paths listed in
+// opts.ReadOnly mounted read-only. When not running as root a user namespace
+// maps the caller to root inside the sandbox. Once the mounts are set up the
+// command runs without capabilities and with no_new_privs, through the stage
+// described in Hardening, so it cannot undo them. Sandboxing requires Linux;
+// elsewhere, or when the host does not allow creating the namespaces,
+// execution fails with ErrSandboxUnavailable. The sh and util-linux mount
+// binaries must be available on the host.
+func (c *Process) Sandbox(opts SandboxOptions) *Process {
+	c = c.Clone()
+	c.sandbox = &opts
+	return c
+}
+
+// check rejects read-only paths the sandbox cannot mount
+func (s *SandboxOptions) check() error {
+	for _, path := range s.ReadOnly {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("invalid sandbox read-only path %q: not absolute", path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("invalid sandbox read-only path: %w", err)
+		}
+	}
+	return nil
+}
+
+// wrap prefixes the command with a shell setting up the mounts inside the new
+// namespaces before executing it through stage. A failing step is reported on
+// descriptor 3, see sandboxSetup, which the stage closes. Read-only paths
+// under /tmp are bound from the host /tmp, kept open as descriptor 5, once
+// the tmpfs covers it.
+func (s *SandboxOptions) wrap(name string, args []string, stage []string) (string, []string) {
+	steps := []string{"mount --make-rprivate /"}
+	var tmpSteps []string
+	for _, path := range s.ReadOnly {
+		path = filepath.Clean(path)
+		p := quoteArg(path)
+		rel, ok := strings.CutPrefix(path, "/tmp")
+		if !ok || rel != "" && rel[0] != '/' {
+			steps = append(steps, "mount --bind "+p+" "+p, "mount -o remount,bind,ro "+p+" "+p)
+			continue
+		}
+		// the mount point is created on the tmpfs
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			tmpSteps = append(tmpSteps, "mkdir -p "+quoteArg(filepath.Dir(path)), "touch "+p)
+		} else {
+			tmpSteps = append(tmpSteps, "mkdir -p "+p)
+		}
+		tmpSteps = append(tmpSteps,
+			"mount --no-canonicalize --bind "+quoteArg("/proc/self/fd/5"+rel)+" "+p,
+			"mount -o remount,bind,ro "+p+" "+p)
+	}
+	tmpSteps = append([]string{"mount -t tmpfs -o mode=1777,nosuid,nodev tmpfs /tmp"}, tmpSteps...)
+	script := `setup() { "$@" 2>&3 || { echo "syscmd-sandbox: $* failed" >&3; exit 1; }; }; ` +
+		"setup " + strings.Join(steps, "; setup ") + "; " +
+		"{ setup " + strings.Join(tmpSteps, "; setup ") + `; } 5</tmp || { echo "syscmd-sandbox: failed to open /tmp" >&3; exit 1; }; ` +
+		`setup mount -t proc proc /proc; exec "$@"`
+	argv := append([]string{"-c", script, "syscmd-sandbox"}, stage...)
+	return "sh", append(append(argv, name), args...)
+}
+
+// sandboxSetup receives the errors of the sandbox wrapper through a pipe
+// passed to the command as descriptor 3. The executable of the hardening
+// stage follows as descriptor 4.
+type sandboxSetup struct {
+	r, w  *os.File
+	stage *os.File
+}
+
+// attachSandboxSetup passes the write end of the setup pipe and the stage
+// executable to cmd
+func attachSandboxSetup(cmd *exec.Cmd, hardened *hardener) (*sandboxSetup, error) {
+	stage, err := stageExecutable()
+	if err != nil {
+		if hardened != nil {
+			return nil, fmt.Errorf("%w: %w", ErrHardeningUnavailable, err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrSandboxUnavailable, err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		stage.Close()
+		return nil, fmt.Errorf("failed to create sandbox setup pipe: %w", err)
+	}
+	cmd.ExtraFiles = []*os.File{w, stage}
+	return &sandboxSetup{r: r, w: w, stage: stage}, nil
+}
+
+// failure returns what the wrapper reported once the command ended, empty
+// when the sandbox was set up. It releases the descriptors and accepts a nil
+// receiver.
+func (s *sandboxSetup) failure() string {
+	if s == nil {
+		return ""
+	}
+	s.w.Close()
+	s.stage.Close()
+	defer s.r.Close()
+	msg, _ := io.ReadAll(io.LimitReader(s.r, 4096))
+	return strings.TrimSpace(string(msg))
+}
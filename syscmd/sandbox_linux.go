@@ -0,0 +1,39 @@
+package syscmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const sandboxHint = "the host refused to create the namespaces or mounts; unprivileged user namespaces may be disabled " +
+	"(see /proc/sys/user/max_user_namespaces and kernel.unprivileged_userns_clone) or blocked by a container seccomp profile"
+
+func checkSandbox() error {
+	return nil
+}
+
+func (s *SandboxOptions) configure(cmd *exec.Cmd) {
+	attr := sysProcAttr(cmd)
+	attr.Cloneflags |= syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if !s.Network {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	if os.Geteuid() != 0 {
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+}
+
+// sandboxUnsupported reports whether the command could not be started because
+// the kernel refused to create the namespaces
+func sandboxUnsupported(err error) bool {
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) || pathErr.Op != "fork/exec" {
+		return false
+	}
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EUSERS)
+}
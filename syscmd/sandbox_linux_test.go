@@ -0,0 +1,140 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runSandboxed runs a shell script in a sandbox, skipping the test when the host does not allow it
+func runSandboxed(t *testing.T, opts SandboxOptions, script string) (*Result, error) {
+	t.Helper()
+	res, err := New(context.Background()).Sandbox(opts).ExecuteResult("sh", "-c", script)
+	if errors.Is(err, ErrSandboxUnavailable) {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	return res, err
+}
+
+func TestSandbox_PIDNamespace(t *testing.T) {
+	res, err := runSandboxed(t, SandboxOptions{}, "echo $$")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n", res.Output)
+}
+
+func TestSandbox_NoNetwork(t *testing.T) {
+	res, err := runSandboxed(t, SandboxOptions{}, "cat /proc/net/dev")
+	require.NoError(t, err)
+	assert.Contains(t, res.Output, "lo:")
+	assert.Equal(t, 3, strings.Count(res.Output, "\n"), "only the loopback interface is expected:\n%s", res.Output)
+}
+
+func TestSandbox_PrivateTmp(t *testing.T) {
+	hostFile, err := os.CreateTemp("", "syscmd-sandbox-")
+	require.NoError(t, err)
+	hostFile.Close()
+	defer os.Remove(hostFile.Name())
+
+	res, err := runSandboxed(t, SandboxOptions{}, "test ! -e "+quoteArg(hostFile.Name())+" && touch /tmp/inside && echo isolated")
+	require.NoError(t, err, res.Output)
+	assert.Equal(t, "isolated\n", res.Output)
+
+	_, err = os.Stat(filepath.Join(os.TempDir(), "inside"))
+	assert.True(t, os.IsNotExist(err), "files written to /tmp must not reach the host")
+}
+
+func TestSandbox_ReadOnlyPaths(t *testing.T) {
+	dir, err := os.MkdirTemp(".", "sandbox-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.Abs(dir)
+
+	res, err := runSandboxed(t, SandboxOptions{ReadOnly: []string{dir}}, "touch "+quoteArg(filepath.Join(dir, "file")))
+	require.Error(t, err)
+	assert.Contains(t, res.Output, "Read-only file system")
+
+	_, err = os.Stat(filepath.Join(dir, "file"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSandbox_KeepsResultSemantics(t *testing.T) {
+	res, err := runSandboxed(t, SandboxOptions{Network: true}, "echo out; exit 7")
+	require.Error(t, err)
+	assert.Equal(t, 7, res.ExitCode)
+	assert.Equal(t, "out\n", res.Output)
+}
+
+func TestSandbox_ReadOnlyPathsUnderTmp(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, []byte("host\n"), 0o644))
+
+	res, err := runSandboxed(t, SandboxOptions{ReadOnly: []string{dir, file}},
+		"cat "+quoteArg(file)+"; touch "+quoteArg(filepath.Join(dir, "new"))+" || echo dir read-only; echo x >"+quoteArg(file)+" || echo file read-only")
+	require.NoError(t, err, res.Output)
+	assert.Contains(t, res.Output, "host\n")
+	assert.Contains(t, res.Output, "dir read-only")
+	assert.Contains(t, res.Output, "file read-only")
+
+	_, err = os.Stat(filepath.Join(dir, "new"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSandbox_DropsCapabilities(t *testing.T) {
+	res, err := runSandboxed(t, SandboxOptions{}, "grep -E '^(CapEff|NoNewPrivs):' /proc/self/status; printenv "+hardeningStageEnv+" || echo clean")
+	require.NoError(t, err)
+	assert.Regexp(t, `CapEff:\s+0000000000000000\n`, res.Output)
+	assert.Regexp(t, `NoNewPrivs:\s+1\n`, res.Output)
+	assert.Contains(t, res.Output, "clean")
+}
+
+func TestSandbox_MountsCannotBeUndone(t *testing.T) {
+	dir, err := os.MkdirTemp(".", "sandbox-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.Abs(dir)
+	hostFile, err := os.CreateTemp("", "syscmd-sandbox-")
+	require.NoError(t, err)
+	hostFile.Close()
+	defer os.Remove(hostFile.Name())
+
+	p := quoteArg(dir)
+	res, err := runSandboxed(t, SandboxOptions{ReadOnly: []string{dir}},
+		"mount -o remount,bind,rw "+p+" "+p+"; touch "+quoteArg(filepath.Join(dir, "file"))+"; "+
+			"umount /tmp; test ! -e "+quoteArg(hostFile.Name())+" && echo isolated")
+	require.NoError(t, err, res.Output)
+	assert.Contains(t, res.Output, "isolated")
+
+	_, err = os.Stat(filepath.Join(dir, "file"))
+	assert.True(t, os.IsNotExist(err), "the read-only mount was made writable:\n%s", res.Output)
+}
+
+func TestSandbox_InvalidReadOnlyPath(t *testing.T) {
+	runSandboxed(t, SandboxOptions{}, "true")
+
+	for _, path := range []string{filepath.Join(t.TempDir(), "missing"), "relative"} {
+		res, err := New(context.Background()).
+			Sandbox(SandboxOptions{ReadOnly: []string{path}}).
+			Retry(2, 10*time.Millisecond).
+			ExecuteResult("echo", "never")
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrSandboxUnavailable, "a bad path is a configuration error")
+		assert.ErrorContains(t, err, "invalid sandbox read-only path")
+		assert.Zero(t, res.Attempts)
+	}
+}
+
+func TestSandbox_CommandFailureIsNotSetupFailure(t *testing.T) {
+	// a command exiting with the status of a failed mount is not mistaken for one
+	res, err := runSandboxed(t, SandboxOptions{}, "exit 32")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrSandboxUnavailable)
+	assert.Equal(t, 32, res.ExitCode)
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package syscmd
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const sandboxHint = "namespaces are only available on Linux"
+
+func checkSandbox() error {
+	return fmt.Errorf("%w: %s", ErrSandboxUnavailable, sandboxHint)
+}
+
+func (s *SandboxOptions) configure(*exec.Cmd) {}
+
+func sandboxUnsupported(error) bool {
+	return false
+}
@@ -0,0 +1,71 @@
+package syscmd
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// strictPreamble enables errexit and nounset, and pipefail where the shell supports it
+const strictPreamble = "set -eu; (set -o pipefail) 2>/dev/null && set -o pipefail\n"
+
+// Interpreter sets the shell running scripts, "sh" by default.
+// It must accept a script with -c, like sh, bash, dash or zsh.
+func (c *Process) Interpreter(shell string) *Process {
+	c = c.Clone()
+	c.shell = shell
+	return c
+}
+
+// NoStrict disables the "set -euo pipefail" preamble prepended to scripts
+func (c *Process) NoStrict() *Process {
+	c = c.Clone()
+	c.noStrict = true
+	return c
+}
+
+// ExecuteScript runs script with the interpreter, with the configured timeout
+// and retry settings. The args are passed as positional parameters $1..$n and
+// are never interpolated into the script text.
+func (c *Process) ExecuteScript(script string, args ...string) (*Result, error) {
+	return c.executeScript("syscmd", script, args)
+}
+
+// ExecuteScriptFS runs the script stored at name in fsys, typically an embed.FS.
+// The script name is available as $0.
+func (c *Process) ExecuteScriptFS(fsys fs.FS, name string, args ...string) (*Result, error) {
+	script, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return &Result{Name: c.interpreter(), ExitCode: -1}, fmt.Errorf("failed to read script: %w", err)
+	}
+	return c.executeScript(path.Base(name), string(script), args)
+}
+
+func (c *Process) executeScript(arg0, script string, args []string) (*Result, error) {
+	if !c.noStrict {
+		script = strictPreamble + script
+	}
+	argv := append([]string{"-c", script, arg0}, args...)
+	if c.expandArgs {
+		c = c.Clone()
+		c.scriptArgs = 3
+	}
+	return c.ExecuteResult(c.interpreter(), argv...)
+}
+
+func (c *Process) interpreter() string {
+	if c.shell == "" {
+		return "sh"
+	}
+	return c.shell
+}
+
+// Script is a convenience function running a shell script with positional arguments
+func Script(ctx context.Context, script string, args ...string) (string, error) {
+	res, err := New(ctx).ExecuteScript(script, args...)
+	if err != nil {
+		return "", err
+	}
+	return res.Output, nil
+}
@@ -0,0 +1,83 @@
+package syscmd
+
+import (
+	"context"
+	"embed"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/greet.sh
+var testScripts embed.FS
+
+func TestScript_PositionalArguments(t *testing.T) {
+	hostile := `$(touch pwned); "quoted" 'single' * ; rm -rf /`
+	output, err := Script(context.Background(), `printf '%s|%s\n' "$1" "$2"`, hostile, "two words")
+	require.NoError(t, err)
+	assert.Equal(t, hostile+"|two words\n", output)
+}
+
+func TestScript_ShellFeatures(t *testing.T) {
+	dir := t.TempDir()
+	res, err := New(context.Background()).Dir(dir).ExecuteScript(`
+		touch a.txt b.txt
+		ls *.txt | wc -l > count
+		cat count
+	`)
+	require.NoError(t, err)
+	assert.Contains(t, res.Output, "2")
+	assert.FileExists(t, filepath.Join(dir, "count"))
+}
+
+func TestScript_StrictMode(t *testing.T) {
+	cmd := New(context.Background())
+
+	_, err := cmd.ExecuteScript("false\necho unreachable")
+	assert.Error(t, err, "errexit")
+
+	_, err = cmd.ExecuteScript(`echo "$UNDEFINED_SYSCMD_VARIABLE"`)
+	assert.Error(t, err, "nounset")
+
+	res, err := New(context.Background()).NoStrict().ExecuteScript("false\necho reached")
+	require.NoError(t, err)
+	assert.Equal(t, "reached\n", res.Output)
+}
+
+func TestScript_Pipefail(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+
+	_, err := New(context.Background()).Interpreter("bash").ExecuteScript("false | true")
+	assert.Error(t, err)
+
+	_, err = New(context.Background()).Interpreter("bash").NoStrict().ExecuteScript("false | true")
+	assert.NoError(t, err)
+}
+
+func TestScript_RetryAndResult(t *testing.T) {
+	res, err := New(context.Background()).
+		Retry(2, 10*time.Millisecond).
+		ExecuteScript("echo attempt; exit 4")
+	require.Error(t, err)
+	assert.Equal(t, 3, res.Attempts)
+	assert.Equal(t, 4, res.ExitCode)
+	assert.Equal(t, "sh", res.Name)
+
+	_, err = New(context.Background()).Timeout(100 * time.Millisecond).ExecuteScript("exec sleep 5")
+	assert.Error(t, err)
+}
+
+func TestScript_EmbeddedFS(t *testing.T) {
+	res, err := New(context.Background()).ExecuteScriptFS(testScripts, "testdata/greet.sh", "world")
+	require.NoError(t, err)
+	assert.Equal(t, "greet.sh: hello world\n", res.Output)
+
+	_, err = New(context.Background()).ExecuteScriptFS(testScripts, "testdata/missing.sh")
+	assert.ErrorContains(t, err, "failed to read script")
+}
@@ -0,0 +1,135 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// ParentDeathSignal sets the signal the command receives when the Go process
+// dies, so commands do not outlive a crashed service. Defaults to SIGKILL;
+// zero disables it. Only effective on Linux.
+func (c *Process) ParentDeathSignal(sig syscall.Signal) *Process {
+	c = c.Clone()
+	c.deathSignal = sig
+	return c
+}
+
+// ProcessGroup starts commands in a process group of their own on Unix, so
+// Shutdown kills the processes they started as well. Such commands no longer
+// receive the signals of the terminal, such as Ctrl-C; use ForwardSignals,
+// which implies ProcessGroup, to relay them.
+func (c *Process) ProcessGroup() *Process {
+	c = c.Clone()
+	c.processGroup = true
+	return c
+}
+
+// child is a running command started by a Process
+type child struct {
+	proc    *os.Process
+	group   bool // leads a process group of its own
+	release func()
+	done    chan struct{}
+	killed  bool // guarded by children.mu
+}
+
+// childSet tracks the running commands for Shutdown and the reaper
+type childSet struct {
+	// starting is held for reading while a command is started and registered
+	// so the reaper never collects a child before it is known
+	starting sync.RWMutex
+
+	mu   sync.Mutex
+	live map[int]*child
+}
+
+var children = &childSet{live: make(map[int]*child)}
+
+// start starts cmd, through hardened when set, and tracks it until finish
+func (s *childSet) start(cmd *exec.Cmd, hardened *hardener) (*child, error) {
+	s.starting.RLock()
+	defer s.starting.RUnlock()
+
+	release := func() {}
+	var err error
+	if hardened != nil {
+		release, err = hardened.start(cmd)
+	} else {
+		err = cmd.Start()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ch := &child{proc: cmd.Process, group: ownProcessGroup(cmd), release: release, done: make(chan struct{})}
+	s.mu.Lock()
+	s.live[ch.proc.Pid] = ch
+	s.mu.Unlock()
+	return ch, nil
+}
+
+// finish forgets a child that has been waited for and reports whether it was
+// killed by Shutdown
+func (s *childSet) finish(ch *child) bool {
+	s.mu.Lock()
+	delete(s.live, ch.proc.Pid)
+	killed := ch.killed
+	s.mu.Unlock()
+
+	ch.release()
+	close(ch.done)
+	return killed
+}
+
+// tracked reports whether pid is a running command started by a Process
+func (s *childSet) tracked(pid int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.live[pid]
+	return ok
+}
+
+// Shutdown kills every command currently started by a Process in this Go
+// process and waits until they have exited or ctx ends. The whole process
+// group of commands started with ProcessGroup or ForwardSignals is killed,
+// reaching the processes they started unless those moved to another group;
+// other commands are killed alone. Killed
+// executions fail with ErrShutdown and are not retried. Commands started
+// later are not affected.
+func Shutdown(ctx context.Context) error {
+	children.mu.Lock()
+	killed := make([]*child, 0, len(children.live))
+	for _, ch := range children.live {
+		ch.killed = true
+		killed = append(killed, ch)
+	}
+	children.mu.Unlock()
+
+	var errs []error
+	for _, ch := range killed {
+		var err error
+		if ch.group {
+			err = signalGroup(ch.proc, os.Kill)
+		} else {
+			err = ch.proc.Kill()
+		}
+		if err != nil && !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH) {
+			errs = append(errs, fmt.Errorf("failed to kill process %d: %w", ch.proc.Pid, err))
+		}
+	}
+
+	for _, ch := range killed {
+		select {
+		case <-ch.done:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("shutdown interrupted while waiting for process %d: %w", ch.proc.Pid, ctx.Err()))
+			return errors.Join(errs...)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,98 @@
+package syscmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func setDeathSignal(cmd *exec.Cmd, sig syscall.Signal) {
+	if sig != 0 {
+		sysProcAttr(cmd).Pdeathsig = sig
+	}
+}
+
+// StartReaper collects orphaned processes until stop is called. It is meant for
+// services running as PID 1 in a container, where orphans are reparented to
+// the service and would otherwise stay zombies. When not running as PID 1
+// the process is made a child subreaper so orphans of its descendants are
+// reparented to it.
+//
+// Only zombies that are not commands started by a Process are collected.
+// Children started with os/exec directly are indistinguishable from orphans
+// and must not be used together with the reaper.
+func StartReaper() (stop func(), err error) {
+	subreaper := os.Getpid() != 1
+	if subreaper {
+		if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+			return nil, fmt.Errorf("failed to become a child subreaper: %w", err)
+		}
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGCHLD)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			reapOrphans()
+			select {
+			case <-sigc:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+			signal.Stop(sigc)
+			if subreaper {
+				unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 0, 0, 0, 0)
+			}
+		})
+	}, nil
+}
+
+// reapOrphans waits for the zombie children not started by a Process
+func reapOrphans() {
+	children.starting.Lock()
+	defer children.starting.Unlock()
+
+	self := os.Getpid()
+	entries, _ := os.ReadDir("/proc")
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || children.tracked(pid) {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// the command name may contain spaces and parentheses, the state and
+		// parent pid follow the last closing parenthesis
+		i := bytes.LastIndexByte(stat, ')')
+		if i < 0 {
+			continue
+		}
+		fields := bytes.Fields(stat[i+1:])
+		if len(fields) < 2 || string(fields[0]) != "Z" || string(fields[1]) != strconv.Itoa(self) {
+			continue
+		}
+		var status unix.WaitStatus
+		unix.Wait4(pid, &status, unix.WNOHANG, nil)
+	}
+}
@@ -0,0 +1,104 @@
+package syscmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParentDeathSignal(t *testing.T) {
+	ctx := context.Background()
+
+	cmd := New(ctx).command(ctx, "true", nil, nil, nil)
+	require.NotNil(t, cmd.SysProcAttr)
+	assert.Equal(t, syscall.SIGKILL, cmd.SysProcAttr.Pdeathsig)
+
+	cmd = New(ctx).ParentDeathSignal(syscall.SIGTERM).command(ctx, "true", nil, nil, nil)
+	assert.Equal(t, syscall.SIGTERM, cmd.SysProcAttr.Pdeathsig)
+
+	cmd = New(ctx).ParentDeathSignal(0).command(ctx, "true", nil, nil, nil)
+	assert.Nil(t, cmd.SysProcAttr)
+}
+
+// running reports whether pid exists and is not a zombie
+func running(pid int) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	// the state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestShutdown_KillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	errc := make(chan error, 1)
+	go func() {
+		_, err := New(context.Background()).ProcessGroup().Execute("sh", "-c", "sleep 30 & echo $! > "+pidFile+"; wait")
+		errc <- err
+	}()
+
+	var pid int
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil || !strings.HasSuffix(string(data), "\n") {
+			return false
+		}
+		pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	require.True(t, running(pid))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, Shutdown(ctx))
+	assert.ErrorIs(t, <-errc, ErrShutdown)
+	assert.Eventually(t, func() bool { return !running(pid) }, time.Second, 10*time.Millisecond,
+		"the background sleep must be killed with the shell")
+}
+
+func TestProcessGroup_OptIn(t *testing.T) {
+	ctx := context.Background()
+
+	// by default commands stay in the group of the Go process and receive
+	// the signals of the terminal
+	cmd := New(ctx).ParentDeathSignal(0).command(ctx, "true", nil, nil, nil)
+	assert.Nil(t, cmd.SysProcAttr)
+
+	cmd = New(ctx).ProcessGroup().command(ctx, "true", nil, nil, nil)
+	assert.True(t, cmd.SysProcAttr.Setpgid)
+
+	pgid, err := New(ctx).Execute("sh", "-c", "ps -o pgid= -p $$")
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(syscall.Getpgrp()), strings.TrimSpace(pgid))
+}
+
+func TestStartReaper(t *testing.T) {
+	stop, err := StartReaper()
+	require.NoError(t, err)
+	defer stop()
+
+	// the shell exits right away, orphaning the background sleep
+	output, err := New(context.Background()).Execute("sh", "-c", "sleep 0.3 >/dev/null 2>&1 & echo $!")
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(output))
+	require.NoError(t, err)
+
+	status, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/status")
+	require.NoError(t, err)
+	assert.Contains(t, string(status), "PPid:\t"+strconv.Itoa(os.Getpid())+"\n", "the orphan is reparented to the reaper")
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat("/proc/" + strconv.Itoa(pid))
+		return os.IsNotExist(err)
+	}, 3*time.Second, 20*time.Millisecond, "the orphan was not reaped")
+}
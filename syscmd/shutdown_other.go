@@ -0,0 +1,17 @@
+//go:build !linux
+
+package syscmd
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+func setDeathSignal(*exec.Cmd, syscall.Signal) {}
+
+// StartReaper collects orphaned processes until stop is called. It is only
+// supported on Linux.
+func StartReaper() (stop func(), err error) {
+	return nil, errors.New("the reaper is only supported on Linux")
+}
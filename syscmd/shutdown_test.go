@@ -0,0 +1,53 @@
+package syscmd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown_KillsRunningCommands(t *testing.T) {
+	const n = 3
+	var wg sync.WaitGroup
+	results := make([]*Result, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = New(context.Background()).Retry(3, 10*time.Millisecond).ExecuteResult("sleep", "5")
+		}(i)
+	}
+
+	require.Eventually(t, func() bool {
+		children.mu.Lock()
+		defer children.mu.Unlock()
+		return len(children.live) == n
+	}, 2*time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, Shutdown(ctx))
+	wg.Wait()
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	for i := 0; i < n; i++ {
+		assert.ErrorIs(t, errs[i], ErrShutdown)
+		assert.Equal(t, 1, results[i].Attempts, "killed commands are not retried")
+		assert.Equal(t, -1, results[i].ExitCode)
+	}
+
+	// later commands run normally
+	output, err := New(context.Background()).Execute("echo", "after")
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", output)
+}
+
+func TestShutdown_NothingRunning(t *testing.T) {
+	assert.NoError(t, Shutdown(context.Background()))
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package syscmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(*exec.Cmd) {}
+
+func ownProcessGroup(*exec.Cmd) bool { return false }
+
+func signalGroup(p *os.Process, sig os.Signal) error {
+	return p.Signal(sig)
+}
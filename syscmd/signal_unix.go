@@ -0,0 +1,36 @@
+//go:build unix
+
+package syscmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a process group of its own
+func setProcessGroup(cmd *exec.Cmd) {
+	sysProcAttr(cmd).Setpgid = true
+}
+
+// ownProcessGroup reports whether cmd is started in a process group of its own
+func ownProcessGroup(cmd *exec.Cmd) bool {
+	return cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid
+}
+
+// signalGroup sends sig to the process group led by p
+func signalGroup(p *os.Process, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Signal(sig)
+	}
+	return syscall.Kill(-p.Pid, s)
+}
+
+// sysProcAttr returns the SysProcAttr of cmd, creating it when needed
+func sysProcAttr(cmd *exec.Cmd) *syscall.SysProcAttr {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	return cmd.SysProcAttr
+}
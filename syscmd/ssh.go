@@ -0,0 +1,489 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig configures the connections of a Remote
+type SSHConfig struct {
+	// User to log in as
+	User string
+
+	// Auth lists the authentication methods, see KeyFileAuth and AgentAuth
+	Auth []ssh.AuthMethod
+
+	// HostKeyCallback verifies the server key. Defaults to checking KnownHostsFiles.
+	HostKeyCallback ssh.HostKeyCallback
+
+	// KnownHostsFiles are used when HostKeyCallback is nil. Defaults to ~/.ssh/known_hosts.
+	KnownHostsFiles []string
+
+	// DialTimeout bounds connecting and the SSH handshake. Defaults to 10 seconds.
+	DialTimeout time.Duration
+}
+
+// KeyFileAuth authenticates with a private key file, decrypting it with
+// passphrase when it is not empty
+func KeyFileAuth(path string, passphrase []byte) (ssh.AuthMethod, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	var signer ssh.Signer
+	if len(passphrase) > 0 {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, passphrase)
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return ssh.PublicKeys(signer), nil
+}
+
+// AgentAuth authenticates with the keys of the agent listening on SSH_AUTH_SOCK.
+// The agent is contacted on first use and the connection is kept open.
+func AgentAuth() ssh.AuthMethod {
+	var (
+		once   sync.Once
+		client agent.ExtendedAgent
+		err    error
+	)
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		once.Do(func() {
+			sock := os.Getenv("SSH_AUTH_SOCK")
+			if sock == "" {
+				err = errors.New("SSH_AUTH_SOCK is not set")
+				return
+			}
+			var conn net.Conn
+			if conn, err = net.Dial("unix", sock); err == nil {
+				client = agent.NewClient(conn)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh agent: %w", err)
+		}
+		return client.Signers()
+	})
+}
+
+// SSHPool shares one client connection per host and configuration between
+// Remotes. Remotes derived from the same NewRemote call share a connection,
+// Remotes created separately never do, as their host key checks and
+// credentials may differ; create one Remote per host and derive the others
+// from it to reuse its connection. Connections without a running command are
+// closed after the idle timeout, broken ones are replaced on next use. It is
+// safe for concurrent use.
+type SSHPool struct {
+	mu      sync.Mutex
+	clients map[string]*sshPoolEntry
+	idle    time.Duration
+}
+
+type sshPoolEntry struct {
+	mu     sync.Mutex // serializes dialing
+	client *ssh.Client
+
+	// guarded by SSHPool.mu
+	sessions int
+	timer    *time.Timer // closes the idle connection
+}
+
+// NewSSHPool creates an empty connection pool closing connections idle for
+// more than one minute
+func NewSSHPool() *SSHPool {
+	return &SSHPool{clients: make(map[string]*sshPoolEntry), idle: time.Minute}
+}
+
+// SetIdleTimeout sets how long a connection without a running command is
+// kept open. Zero keeps connections until Close.
+func (p *SSHPool) SetIdleTimeout(d time.Duration) {
+	p.mu.Lock()
+	p.idle = d
+	p.mu.Unlock()
+}
+
+// Close closes all pooled connections
+func (p *SSHPool) Close() error {
+	p.mu.Lock()
+	entries := p.clients
+	p.clients = make(map[string]*sshPoolEntry)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, entry := range entries {
+		errs = append(errs, p.closeEntry(entry))
+	}
+	return errors.Join(errs...)
+}
+
+// closeEntry closes the connection of an entry removed from the pool
+func (p *SSHPool) closeEntry(entry *sshPoolEntry) error {
+	p.mu.Lock()
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+	p.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.client == nil {
+		return nil
+	}
+	err := entry.client.Close()
+	entry.client = nil
+	return err
+}
+
+// sshConfigIDs numbers the configurations passed to NewRemote
+var sshConfigIDs atomic.Uint64
+
+// sshPoolKey identifies the connections of a configuration to addr
+func sshPoolKey(addr string, cfgID uint64, cfg *SSHConfig) string {
+	return fmt.Sprintf("%s@%s#%d", cfg.User, addr, cfgID)
+}
+
+// get returns the client for the configuration, connecting when needed. The
+// returned function must be called once the client is no longer used.
+func (p *SSHPool) get(ctx context.Context, addr string, cfgID uint64, cfg *SSHConfig) (*ssh.Client, func(), error) {
+	key := sshPoolKey(addr, cfgID, cfg)
+
+	p.mu.Lock()
+	entry, ok := p.clients[key]
+	if !ok {
+		entry = &sshPoolEntry{}
+		p.clients[key] = entry
+	}
+	entry.sessions++
+	if entry.timer != nil {
+		entry.timer.Stop()
+		entry.timer = nil
+	}
+	p.mu.Unlock()
+	release := func() { p.release(key, entry) }
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.client != nil {
+		return entry.client, release, nil
+	}
+	client, err := dialSSH(ctx, addr, cfg)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	entry.client = client
+	return client, release, nil
+}
+
+// release ends a use of the entry and closes it once it stayed idle
+func (p *SSHPool) release(key string, entry *sshPoolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry.sessions--
+	if entry.sessions > 0 || p.idle <= 0 || p.clients[key] != entry {
+		return
+	}
+	entry.timer = time.AfterFunc(p.idle, func() {
+		p.mu.Lock()
+		if entry.sessions > 0 || p.clients[key] != entry {
+			p.mu.Unlock()
+			return
+		}
+		delete(p.clients, key)
+		p.mu.Unlock()
+		p.closeEntry(entry)
+	})
+}
+
+// forget removes the entries of a configuration and closes their connections
+func (p *SSHPool) forget(addr string, cfgID uint64, cfg *SSHConfig) error {
+	key := sshPoolKey(addr, cfgID, cfg)
+	p.mu.Lock()
+	entry, ok := p.clients[key]
+	delete(p.clients, key)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return p.closeEntry(entry)
+}
+
+// drop forgets a broken client unless it was already replaced
+func (p *SSHPool) drop(addr string, cfgID uint64, cfg *SSHConfig, client *ssh.Client) {
+	p.mu.Lock()
+	entry, ok := p.clients[sshPoolKey(addr, cfgID, cfg)]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	entry.mu.Lock()
+	if entry.client == client {
+		entry.client = nil
+	}
+	entry.mu.Unlock()
+	client.Close()
+}
+
+func dialSSH(ctx context.Context, addr string, cfg *SSHConfig) (*ssh.Client, error) {
+	hostKeyCallback := cfg.HostKeyCallback
+	if hostKeyCallback == nil {
+		files := cfg.KnownHostsFiles
+		if len(files) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+			}
+			files = []string{filepath.Join(home, ".ssh", "known_hosts")}
+		}
+		var err error
+		if hostKeyCallback, err = knownhosts.New(files...); err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+		}
+	}
+
+	timeout := cfg.DialTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	// the handshake is not context aware, bound it with a deadline
+	conn.SetDeadline(time.Now().Add(timeout))
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            cfg.Auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+var defaultSSHPool = NewSSHPool()
+
+// Remote runs commands on a host over SSH with the same timeout, retry,
+// Result and exit code semantics as Process. Arguments are quoted for the
+// remote shell, Env and Dir are applied through the command line. Like
+// Process, a Remote is immutable and safe to share.
+type Remote struct {
+	ctx        context.Context
+	addr       string
+	cfg        SSHConfig
+	cfgID      uint64 // identifies cfg in the pool
+	pool       *SSHPool
+	timeout    time.Duration
+	retries    int
+	retryDelay time.Duration
+	env        []string
+	dir        string
+}
+
+// Ensure Remote implements Command at compile time
+var _ Command = (*Remote)(nil)
+
+// NewRemote creates a Remote for host, given as host or host:port, with the
+// same defaults as New. Connections are shared through a package-wide pool
+// between the Remotes derived from the returned one and closed when idle or
+// by Close.
+func NewRemote(ctx context.Context, host string, cfg SSHConfig) *Remote {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	return &Remote{
+		ctx:        ctx,
+		addr:       host,
+		cfg:        cfg,
+		cfgID:      sshConfigIDs.Add(1),
+		pool:       defaultSSHPool,
+		timeout:    30 * time.Second,
+		retryDelay: 1 * time.Second,
+	}
+}
+
+// Clone returns an independent copy of r
+func (r *Remote) Clone() *Remote {
+	cp := *r
+	cp.env = slices.Clone(r.env)
+	cp.cfg.Auth = slices.Clone(r.cfg.Auth)
+	cp.cfg.KnownHostsFiles = slices.Clone(r.cfg.KnownHostsFiles)
+	return &cp
+}
+
+// Close closes the pooled connection of r and of the Remotes derived from it.
+// They reconnect on next use.
+func (r *Remote) Close() error {
+	return r.pool.forget(r.addr, r.cfgID, &r.cfg)
+}
+
+// Pool sets the connection pool used by the remote
+func (r *Remote) Pool(p *SSHPool) *Remote {
+	r = r.Clone()
+	r.pool = p
+	return r
+}
+
+// Timeout sets the timeout for command execution
+func (r *Remote) Timeout(timeout time.Duration) *Remote {
+	r = r.Clone()
+	r.timeout = timeout
+	return r
+}
+
+// Retry sets the number of retries and delay between retries
+func (r *Remote) Retry(retries int, delay time.Duration) *Remote {
+	r = r.Clone()
+	r.retries = retries
+	r.retryDelay = delay
+	return r
+}
+
+// Env adds environment variables in KEY=VALUE form
+func (r *Remote) Env(env ...string) *Remote {
+	r = r.Clone()
+	r.env = append(r.env, env...)
+	return r
+}
+
+// Dir sets the remote working directory of the command
+func (r *Remote) Dir(dir string) *Remote {
+	r = r.Clone()
+	r.dir = dir
+	return r
+}
+
+// Execute runs the command on the remote host
+func (r *Remote) Execute(name string, args ...string) (string, error) {
+	res, err := r.ExecuteResult(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return res.Output, nil
+}
+
+// ExecuteResult runs the command on the remote host and reports the details
+// of the execution. The returned Result is never nil.
+func (r *Remote) ExecuteResult(name string, args ...string) (*Result, error) {
+	res := &Result{Name: name, Args: args, Dir: r.dir, ExitCode: -1}
+	line := Spec{Name: name, Args: args, Env: r.env, Dir: r.dir}.String()
+
+	start := time.Now()
+	err := retry(r.ctx, r.retries, r.retryDelay, func() error {
+		var execCtx context.Context
+		var cancel context.CancelFunc
+
+		if r.timeout > 0 {
+			execCtx, cancel = context.WithTimeout(r.ctx, r.timeout)
+		} else {
+			execCtx, cancel = context.WithCancel(r.ctx)
+		}
+		defer cancel()
+
+		res.Attempts++
+		output, code, err := r.run(execCtx, line)
+		res.Output = string(output)
+		res.ExitCode = code
+		if err != nil {
+			return fmt.Errorf("command failed: %w, output: %s", err, string(output))
+		}
+		return nil
+	}, nil)
+	res.Duration = time.Since(start)
+	return res, err
+}
+
+// run executes the command line in a new session, reconnecting once when the
+// pooled connection turns out to be broken
+func (r *Remote) run(ctx context.Context, line string) ([]byte, int, error) {
+	var session *ssh.Session
+	for i := 0; ; i++ {
+		client, release, err := r.pool.get(ctx, r.addr, r.cfgID, &r.cfg)
+		if err != nil {
+			return nil, -1, err
+		}
+		session, err = client.NewSession()
+		if err == nil {
+			defer release()
+			break
+		}
+		r.pool.drop(r.addr, r.cfgID, &r.cfg, client)
+		release()
+		if i > 0 {
+			return nil, -1, fmt.Errorf("failed to open ssh session: %w", err)
+		}
+	}
+	defer session.Close()
+
+	var output lockedBuffer
+	session.Stdout = &output
+	session.Stderr = &output
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(line) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		return output.Bytes(), -1, ctx.Err()
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return output.Bytes(), 0, nil
+	case errors.As(err, &exitErr):
+		return output.Bytes(), exitErr.ExitStatus(), err
+	default:
+		return output.Bytes(), -1, err
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent stdout and stderr copies of a session
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
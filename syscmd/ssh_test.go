@@ -0,0 +1,388 @@
+//go:build unix
+
+package syscmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process SSH server running exec requests with sh -c
+type testSSHServer struct {
+	addr        string
+	hostKey     ssh.PublicKey
+	connections atomic.Int32
+	listener    net.Listener
+}
+
+func newTestSSHServer(t *testing.T, authorized ssh.PublicKey) *testSSHServer {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &testSSHServer{addr: listener.Addr().String(), hostKey: hostSigner.PublicKey(), listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			srv.connections.Add(1)
+			go srv.serve(conn, config)
+		}
+	}()
+	return srv
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(ch, requests)
+	}
+}
+
+func (s *testSSHServer) session(ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+
+	var cmd *exec.Cmd
+	done := make(chan struct{})
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			req.Reply(true, nil)
+
+			cmd = exec.Command("sh", "-c", payload.Command)
+			cmd.Stdout = ch
+			cmd.Stderr = ch.Stderr()
+			if err := cmd.Start(); err != nil {
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{127}))
+				return
+			}
+			go func() {
+				cmd.Wait()
+				close(done)
+				status := uint32(cmd.ProcessState.ExitCode())
+				if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+					ch.SendRequest("exit-signal", false, ssh.Marshal(struct {
+						Signal     string
+						CoreDumped bool
+						Error      string
+						Lang       string
+					}{Signal: "KILL"}))
+				} else {
+					ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				}
+				ch.Close()
+			}()
+		case "signal":
+			if cmd != nil && cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+		<-done
+	}
+}
+
+// newTestClientKey writes a client key to a temp file and returns its path and signer
+func newTestClientKey(t *testing.T) (string, ssh.Signer) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return path, signer
+}
+
+func writeKnownHosts(t *testing.T, srv *testSSHServer) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, srv.hostKey)
+	require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0o600))
+	return path
+}
+
+func newTestRemote(t *testing.T) (*Remote, *testSSHServer) {
+	t.Helper()
+
+	keyFile, signer := newTestClientKey(t)
+	srv := newTestSSHServer(t, signer.PublicKey())
+	auth, err := KeyFileAuth(keyFile, nil)
+	require.NoError(t, err)
+
+	pool := NewSSHPool()
+	t.Cleanup(func() { pool.Close() })
+
+	remote := NewRemote(context.Background(), srv.addr, SSHConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{auth},
+		KnownHostsFiles: []string{writeKnownHosts(t, srv)},
+	}).Pool(pool)
+	return remote, srv
+}
+
+func TestRemote_Execute(t *testing.T) {
+	remote, _ := newTestRemote(t)
+
+	output, err := remote.Execute("echo", "hello", "it's quoted; $(not expanded)")
+	require.NoError(t, err)
+	assert.Equal(t, "hello it's quoted; $(not expanded)\n", output)
+}
+
+func TestRemote_ExitCode(t *testing.T) {
+	remote, _ := newTestRemote(t)
+
+	res, err := remote.ExecuteResult("sh", "-c", "echo out; echo err >&2; exit 3")
+	require.Error(t, err)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Equal(t, 1, res.Attempts)
+	assert.Contains(t, res.Output, "out")
+	assert.Contains(t, res.Output, "err")
+
+	var exitErr *ssh.ExitError
+	assert.True(t, errors.As(err, &exitErr))
+}
+
+func TestRemote_EnvAndDir(t *testing.T) {
+	remote, _ := newTestRemote(t)
+	dir := t.TempDir()
+
+	output, err := remote.Env("GREETING=hello world").Dir(dir).Execute("sh", "-c", `echo "$GREETING"; pwd`)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world\n"+dir+"\n", output)
+}
+
+func TestRemote_BuilderReturnsCopies(t *testing.T) {
+	remote, _ := newTestRemote(t)
+	base := remote.Env("SHARED=base")
+
+	derived := base.Env("OWN=1").Timeout(time.Second)
+	output, err := derived.Execute("sh", "-c", `echo "$SHARED $OWN"`)
+	require.NoError(t, err)
+	assert.Equal(t, "base 1\n", output)
+
+	output, err = base.Execute("sh", "-c", `echo "$SHARED ${OWN:-unset}"`)
+	require.NoError(t, err)
+	assert.Equal(t, "base unset\n", output)
+	assert.Equal(t, 30*time.Second, base.timeout)
+}
+
+func TestRemote_ConnectionReuse(t *testing.T) {
+	remote, srv := newTestRemote(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := remote.Execute("true")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), srv.connections.Load())
+}
+
+func TestRemote_Close(t *testing.T) {
+	remote, srv := newTestRemote(t)
+
+	_, err := remote.Execute("true")
+	require.NoError(t, err)
+	require.NoError(t, remote.Timeout(time.Second).Close(), "derived Remotes close the shared connection")
+	assert.Empty(t, remote.pool.clients)
+
+	_, err = remote.Execute("true")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), srv.connections.Load())
+}
+
+func TestSSHPool_ClosesIdleConnections(t *testing.T) {
+	remote, srv := newTestRemote(t)
+	remote.pool.SetIdleTimeout(100 * time.Millisecond)
+
+	// a running command keeps the connection open
+	_, err := remote.Execute("sleep", "0.2")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), srv.connections.Load())
+
+	assert.Eventually(t, func() bool {
+		remote.pool.mu.Lock()
+		defer remote.pool.mu.Unlock()
+		return len(remote.pool.clients) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = remote.Execute("true")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), srv.connections.Load())
+}
+
+func TestRemote_Retry(t *testing.T) {
+	remote, srv := newTestRemote(t)
+
+	res, err := remote.Retry(2, 10*time.Millisecond).ExecuteResult("false")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed after 2 retries")
+	assert.Equal(t, 3, res.Attempts)
+	assert.Equal(t, 1, res.ExitCode)
+	assert.Equal(t, int32(1), srv.connections.Load())
+}
+
+func TestRemote_Timeout(t *testing.T) {
+	remote, _ := newTestRemote(t)
+
+	start := time.Now()
+	res, err := remote.Timeout(200*time.Millisecond).ExecuteResult("sleep", "5")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// the connection is still usable
+	_, err = remote.Timeout(5 * time.Second).Execute("true")
+	assert.NoError(t, err)
+}
+
+func TestRemote_UnknownHostKey(t *testing.T) {
+	keyFile, signer := newTestClientKey(t)
+	srv := newTestSSHServer(t, signer.PublicKey())
+	other := newTestSSHServer(t, signer.PublicKey())
+	auth, err := KeyFileAuth(keyFile, nil)
+	require.NoError(t, err)
+
+	// known_hosts lists the key of another server for this address
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, other.hostKey)
+	require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0o600))
+
+	_, err = NewRemote(context.Background(), srv.addr, SSHConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{auth},
+		KnownHostsFiles: []string{path},
+	}).Pool(NewSSHPool()).Execute("true")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "handshake")
+}
+
+func TestRemote_PoolSeparatesConfigs(t *testing.T) {
+	keyFile, signer := newTestClientKey(t)
+	srv := newTestSSHServer(t, signer.PublicKey())
+	other := newTestSSHServer(t, signer.PublicKey())
+	auth, err := KeyFileAuth(keyFile, nil)
+	require.NoError(t, err)
+	pool := NewSSHPool()
+	t.Cleanup(func() { pool.Close() })
+
+	lax := NewRemote(context.Background(), srv.addr, SSHConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}).Pool(pool)
+	_, err = lax.Execute("true")
+	require.NoError(t, err)
+
+	// a strict Remote for the same user and host does not reuse the lax connection
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.addr)}, other.hostKey)
+	require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0o600))
+	_, err = NewRemote(context.Background(), srv.addr, SSHConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{auth},
+		KnownHostsFiles: []string{path},
+	}).Pool(pool).Execute("true")
+	require.ErrorContains(t, err, "handshake")
+
+	// Remotes derived from the lax one still share its connection
+	_, err = lax.Timeout(time.Second).Execute("true")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), srv.connections.Load())
+}
+
+func TestRemote_AgentAuth(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: priv}))
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	srv := newTestSSHServer(t, signer.PublicKey())
+	output, err := NewRemote(context.Background(), srv.addr, SSHConfig{
+		User:            "tester",
+		Auth:            []ssh.AuthMethod{AgentAuth()},
+		KnownHostsFiles: []string{writeKnownHosts(t, srv)},
+	}).Pool(NewSSHPool()).Execute("echo", "agent")
+	require.NoError(t, err)
+	assert.Equal(t, "agent\n", output)
+}
@@ -2,8 +2,15 @@ package syscmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -14,12 +21,39 @@ type Command interface {
 	Execute(name string, args ...string) (string, error)
 }
 
-// Command provides a fluent interface for executing system commands with timeout and retry
+// Command provides a fluent interface for executing system commands with timeout and retry.
+// A Process is immutable: every builder method returns a modified copy, so a
+// base Process can be shared between goroutines and customized per call.
 type Process struct {
-	ctx        context.Context
-	timeout    time.Duration
-	retries    int
-	retryDelay time.Duration
+	ctx               context.Context
+	timeout           time.Duration
+	retries           int
+	retryDelay        time.Duration
+	env               []string
+	dir               string
+	policy            *Policy
+	auditLog          *AuditLog
+	dryRun            bool
+	recorder          *DryRunRecorder
+	limiter           *Limiter
+	lock              *fileLock
+	shell             string
+	noStrict          bool
+	sandbox           *SandboxOptions
+	hardening         *HardeningOptions
+	deathSignal       syscall.Signal
+	forwardSignals    []os.Signal
+	processGroup      bool
+	hooks             hookList
+	logger            *slog.Logger
+	envFiles          []string
+	expandArgs        bool
+	scriptArgs        int // leading arguments running a script, never expanded
+	stripANSI         bool
+	normalizeNewlines bool
+	charset           string
+	maxOutput         int
+	tee               *teeLog
 }
 
 // Ensure Command implements Executor at compile time
@@ -28,68 +62,433 @@ var _ Command = (*Process)(nil)
 // New creates a new system command instance with context and default values
 func New(ctx context.Context) *Process {
 	return &Process{
-		ctx:        ctx,
-		timeout:    30 * time.Second, // default timeout
-		retries:    0,                // no retries by default
-		retryDelay: 1 * time.Second,  // default retry delay
+		ctx:         ctx,
+		timeout:     30 * time.Second, // default timeout
+		retries:     0,                // no retries by default
+		retryDelay:  1 * time.Second,  // default retry delay
+		deathSignal: syscall.SIGKILL,
 	}
 }
 
+// Clone returns an independent copy of c
+func (c *Process) Clone() *Process {
+	cp := *c
+	cp.env = slices.Clone(c.env)
+	cp.hooks = slices.Clone(c.hooks)
+	cp.forwardSignals = slices.Clone(c.forwardSignals)
+	cp.envFiles = slices.Clone(c.envFiles)
+	return &cp
+}
+
 // Timeout sets the timeout for command execution
 func (c *Process) Timeout(timeout time.Duration) *Process {
+	c = c.Clone()
 	c.timeout = timeout
 	return c
 }
 
 // Retry sets the number of retries and delay between retries
 func (c *Process) Retry(retries int, delay time.Duration) *Process {
+	c = c.Clone()
 	c.retries = retries
 	c.retryDelay = delay
 	return c
 }
 
+// Env adds environment variables in KEY=VALUE form on top of the inherited environment
+func (c *Process) Env(env ...string) *Process {
+	c = c.Clone()
+	c.env = append(c.env, env...)
+	return c
+}
+
+// Dir sets the working directory of the command
+func (c *Process) Dir(dir string) *Process {
+	c = c.Clone()
+	c.dir = dir
+	return c
+}
+
+// Policy restricts the commands this process may execute. It is enforced in
+// addition to the global policy set with SetPolicy.
+func (c *Process) Policy(p *Policy) *Process {
+	c = c.Clone()
+	c.policy = p
+	return c
+}
+
+// Audit records every execution of this process to the audit log, in
+// addition to the global log set with SetAuditLog.
+func (c *Process) Audit(a *AuditLog) *Process {
+	c = c.Clone()
+	c.auditLog = a
+	return c
+}
+
+// DryRun makes Execute record the resolved command instead of running it.
+// rec collects the planned commands and may be nil. See also WithDryRun.
+func (c *Process) DryRun(rec *DryRunRecorder) *Process {
+	c = c.Clone()
+	c.dryRun = true
+	c.recorder = rec
+	return c
+}
+
+// Limit makes executions wait for the concurrency and rate limits of l.
+// A concurrency slot is held for the whole execution, each attempt consumes
+// a rate token.
+func (c *Process) Limit(l *Limiter) *Process {
+	c = c.Clone()
+	c.limiter = l
+	return c
+}
+
+// Lock serializes executions across processes with an advisory lock on the
+// file at path. The lock is held for the whole execution including retries;
+// waiting for it is bounded by the process context.
+func (c *Process) Lock(path string) *Process {
+	c = c.Clone()
+	c.lock = &fileLock{path: path}
+	return c
+}
+
+// TryLock is like Lock but fails with ErrLocked instead of waiting when the
+// lock is held by another process
+func (c *Process) TryLock(path string) *Process {
+	c = c.Clone()
+	c.lock = &fileLock{path: path, try: true}
+	return c
+}
+
+// Result describes a command execution
+type Result struct {
+	Name      string
+	Args      []string
+	Dir       string
+	Output    string        // combined output of the last attempt, see TeeToFile for its ordering
+	ExitCode  int           // exit code of the last attempt, -1 if it did not exit normally
+	Attempts  int           // number of times the command was started
+	Duration  time.Duration // total time including retries, excluding QueueWait
+	QueueWait time.Duration // time spent waiting for a Limiter
+	DryRun    bool          // the command was not run, Output and ExitCode are canned
+	LogFile   string        // file the output was teed to, see TeeToFile
+	LogErr    error         // first failure writing LogFile, the command itself is unaffected
+}
+
 // Execute runs the command with the configured timeout and retry settings
 func (c *Process) Execute(name string, args ...string) (string, error) {
-	var finalOutput string
+	res, err := c.ExecuteResult(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return res.Output, nil
+}
 
-	operation := func() error {
-		var execCtx context.Context
-		var cancel context.CancelFunc
+// ExecuteResult runs the command like Execute and reports the details of the
+// execution. The returned Result is never nil, even when err is not.
+func (c *Process) ExecuteResult(name string, args ...string) (*Result, error) {
+	res := &Result{Name: name, Args: args, Dir: c.dir, ExitCode: -1}
+	start := time.Now()
+	e := &Execution{Name: name, Args: args, Dir: c.dir, Start: start, hooks: c.instrumentation()}
+
+	ctx := c.ctx
+	_, dryRun := c.dryRunRecorder()
+	if !dryRun {
+		ctx = e.hooks.start(ctx, e)
+	}
+	err := c.execute(ctx, e, res)
+	res.Duration = time.Since(start) - res.QueueWait
+	if e.tee != nil {
+		res.LogErr = e.tee.finish(res, err)
+	}
+	if !res.DryRun {
+		c.audit(start, res, err)
+	}
+	if !dryRun {
+		e.hooks.finish(ctx, e, res, err)
+	}
+	return res, err
+}
+
+// execute runs the stages of an execution; ctx carries the values set by
+// hooks and ends with the process context
+func (c *Process) execute(ctx context.Context, e *Execution, res *Result) error {
+	c, err := c.resolveEnv(res)
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkPolicy(res.Name, res.Args); err != nil {
+		return err
+	}
+
+	if rec, ok := c.dryRunRecorder(); ok {
+		return c.plan(rec, res)
+	}
+
+	if c.sandbox != nil {
+		if err := checkSandbox(); err != nil {
+			return err
+		}
+		if err := c.sandbox.check(); err != nil {
+			return err
+		}
+	}
+
+	if c.charset != "" {
+		if _, err := lookupCharset(c.charset); err != nil {
+			return err
+		}
+	}
 
-		if c.timeout > 0 {
-			execCtx, cancel = context.WithTimeout(c.ctx, c.timeout)
-		} else {
-			execCtx, cancel = context.WithCancel(c.ctx)
+	var hardened *hardener
+	if c.hardening != nil {
+		var err error
+		if hardened, err = c.hardening.compile(); err != nil {
+			return err
 		}
-		defer cancel()
+	}
 
-		cmd := exec.CommandContext(execCtx, name, args...)
+	var limit *limitState
+	if c.limiter != nil {
+		limit = c.limiter.state(res.Name, res.Args)
+		queued := time.Now()
+		release, err := limit.acquire(c.ctx)
+		res.QueueWait += time.Since(queued)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
 
-		output, err := cmd.CombinedOutput()
+	if c.lock != nil {
+		release, err := c.lock.acquire(c.ctx)
 		if err != nil {
-			return fmt.Errorf("command failed: %w, output: %s", err, string(output))
+			return err
+		}
+		defer release()
+	}
+
+	if c.tee != nil {
+		if e.tee, err = c.tee.begin(res); err != nil {
+			return err
 		}
+		res.LogFile = c.tee.path
+	}
+
+	operation := func() error {
+		if limit != nil {
+			queued := time.Now()
+			err := limit.wait(c.ctx)
+			res.QueueWait += time.Since(queued)
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+		}
+
+		res.Attempts++
+		a := &Attempt{Number: res.Attempts, Start: time.Now()}
+		attemptCtx := e.hooks.attempt(ctx, e, a)
+		err := c.attempt(attemptCtx, e, a, res, hardened)
+		e.hooks.attemptDone(attemptCtx, e, a, res, err)
+		return err
+	}
+	notify := func(err error, delay time.Duration) {
+		e.hooks.retry(ctx, e, err, delay)
+	}
+
+	return retry(c.ctx, c.retries, c.retryDelay, operation, notify)
+}
+
+// attempt runs the command once, filling the output and exit code of res
+func (c *Process) attempt(ctx context.Context, e *Execution, a *Attempt, res *Result, hardened *hardener) error {
+	var execCtx context.Context
+	var cancel context.CancelFunc
+
+	if c.timeout > 0 {
+		execCtx, cancel = context.WithTimeout(ctx, c.timeout)
+	} else {
+		execCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
 
-		finalOutput = string(output)
+	if e.tee != nil {
+		e.tee.mark("attempt %d", a.Number)
+	}
+
+	cmd := c.command(execCtx, res.Name, res.Args, a.Env, hardened)
+	var setup *sandboxSetup
+	starter := hardened
+	if c.sandbox != nil {
+		var err error
+		if setup, err = attachSandboxSetup(cmd, hardened); err != nil {
+			return backoff.Permanent(err)
+		}
+		// the hardening stage inside the sandbox applies the restrictions
+		starter = nil
+	}
+	output, err := c.run(cmd, starter, e.tee)
+	setupFailure := setup.failure()
+	res.Output = string(output)
+	res.ExitCode = -1
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if e.tee != nil {
+		e.tee.mark("attempt %d exited with code %d in %s", a.Number, res.ExitCode, time.Since(a.Start).Round(time.Millisecond))
+	}
+	if err == nil {
 		return nil
 	}
+	if c.sandbox != nil && sandboxUnsupported(err) {
+		return backoff.Permanent(fmt.Errorf("%w: %w (%s)", ErrSandboxUnavailable, err, sandboxHint))
+	}
+	if hardened != nil && strings.HasPrefix(setupFailure, hardeningStageName+":") {
+		return backoff.Permanent(fmt.Errorf("%w: %s", ErrHardeningUnavailable, setupFailure))
+	}
+	if setupFailure != "" {
+		return backoff.Permanent(fmt.Errorf("%w: %s (%s)", ErrSandboxUnavailable, setupFailure, sandboxHint))
+	}
+	if hardened != nil && killedBySeccomp(cmd) {
+		return backoff.Permanent(fmt.Errorf("%w: %w, output: %s", ErrSeccompViolation, err, string(output)))
+	}
+	if errors.Is(err, ErrHardeningUnavailable) {
+		return backoff.Permanent(err)
+	}
+	if errors.Is(err, ErrShutdown) {
+		return backoff.Permanent(fmt.Errorf("command failed: %w, output: %s", err, string(output)))
+	}
+	if ctxErr := execCtx.Err(); ctxErr != nil {
+		// killed because of the timeout or the process context
+		err = fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return fmt.Errorf("command failed: %w, output: %s", err, string(output))
+}
+
+// retry runs operation, retrying it with exponential backoff starting at delay.
+// notify, when not nil, is called with the error and delay before each retry.
+func retry(ctx context.Context, retries int, delay time.Duration, operation func() error, notify backoff.Notify) error {
+	if retries <= 0 {
+		return operation()
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = delay
+	b.MaxElapsedTime = time.Duration(retries+1) * delay * 2
+	contextBackoff := backoff.WithContext(b, ctx)
+	err := backoff.RetryNotify(operation, backoff.WithMaxRetries(contextBackoff, uint64(retries)), notify)
+	if err != nil {
+		return fmt.Errorf("command failed after %d retries: %w", retries, err)
+	}
+	return nil
+}
+
+// under returns a copy of c that is canceled when either ctx or the process
+// context ends. Values of the process context, such as dry-run mode or the
+// actor, are kept and take precedence over those of ctx. The returned
+// function releases its resources.
+func (c *Process) under(ctx context.Context) (*Process, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(c.ctx, cancel)
+
+	cp := c.Clone()
+	cp.ctx = valuesContext{Context: ctx, values: c.ctx}
+	return cp, func() {
+		stop()
+		cancel()
+	}
+}
+
+// valuesContext looks values up in values first and in Context after
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (v valuesContext) Value(key any) any {
+	if value := v.values.Value(key); value != nil {
+		return value
+	}
+	return v.Context.Value(key)
+}
+
+// command builds the exec.Cmd for a single attempt with extra variables set on
+// top of the process environment. A sandboxed command is run through the
+// hardening stage, which only drops capabilities when hardened is nil.
+func (c *Process) command(ctx context.Context, name string, args []string, extraEnv []string, hardened *hardener) *exec.Cmd {
+	if c.sandbox != nil {
+		stage := hardened
+		if stage == nil {
+			stage = &hardener{}
+		}
+		env, argv := stage.stage()
+		extraEnv = append(slices.Clip(extraEnv), env)
+		name, args = c.sandbox.wrap(name, args, argv)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	if c.sandbox != nil {
+		c.sandbox.configure(cmd)
+	}
+	setDeathSignal(cmd, c.deathSignal)
+	if c.processGroup || len(c.forwardSignals) > 0 {
+		setProcessGroup(cmd)
+	}
+	cmd.Dir = c.dir
+	if len(c.env) > 0 || len(extraEnv) > 0 {
+		cmd.Env = append(append(os.Environ(), c.env...), extraEnv...)
+	}
+	return cmd
+}
 
-	if c.retries > 0 {
-		b := backoff.NewExponentialBackOff()
-		b.InitialInterval = c.retryDelay
-		b.MaxElapsedTime = time.Duration(c.retries+1) * c.retryDelay * 2
-		contextBackoff := backoff.WithContext(b, c.ctx)
-		err := backoff.Retry(operation, backoff.WithMaxRetries(contextBackoff, uint64(c.retries)))
+// run starts cmd, through hardened when set, and returns its combined output
+// after the configured output transformations. With a tee, stdout and stderr
+// are transformed separately and also written to tee.
+func (c *Process) run(cmd *exec.Cmd, hardened *hardener, tee *teeExecution) ([]byte, error) {
+	output := &captureBuffer{max: c.maxOutput}
+	var writers, tees []io.WriteCloser
+	if tee == nil {
+		w, err := c.outputWriter(output)
 		if err != nil {
-			return "", fmt.Errorf("command failed after %d retries: %w", c.retries, err)
+			return nil, err
 		}
+		cmd.Stdout = w
+		cmd.Stderr = w
+		writers = append(writers, w)
 	} else {
-		if err := operation(); err != nil {
-			return "", err
+		for _, tag := range []string{"stdout", "stderr"} {
+			t := tee.stream(tag)
+			w, err := c.outputWriter(io.MultiWriter(output, t))
+			if err != nil {
+				return nil, err
+			}
+			writers = append(writers, w)
+			tees = append(tees, t)
 		}
+		cmd.Stdout = writers[0]
+		cmd.Stderr = writers[1]
 	}
-
-	return finalOutput, nil
+	ch, err := children.start(cmd, hardened)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.forwardSignals) > 0 {
+		stop := forward(ch.proc, c.forwardSignals)
+		defer stop()
+	}
+	err = cmd.Wait()
+	if children.finish(ch) {
+		err = fmt.Errorf("%w: %w", ErrShutdown, err)
+	}
+	for _, w := range writers {
+		if flushErr := w.Close(); err == nil && flushErr != nil {
+			err = fmt.Errorf("failed to decode output: %w", flushErr)
+		}
+	}
+	// the tees last, they receive what the transformations flushed
+	for _, t := range tees {
+		t.Close()
+	}
+	return output.Bytes(), err
 }
 
 // Run is a convenience function for simple command execution
@@ -2,6 +2,7 @@ package syscmd
 
 import (
 	"context"
+	"fmt"
 	"runtime"
 	"sync"
 	"testing"
@@ -46,6 +47,77 @@ func TestChaining(t *testing.T) {
 	assert.Equal(t, 500*time.Millisecond, cmd.retryDelay)
 }
 
+func TestBuilder_ReturnsCopies(t *testing.T) {
+	base := New(context.Background()).Env("A=1")
+
+	derived := base.Timeout(time.Second).Retry(2, time.Millisecond).Env("B=2").Dir("/tmp")
+	assert.Equal(t, time.Second, derived.timeout)
+	assert.Equal(t, []string{"A=1", "B=2"}, derived.env)
+
+	assert.Equal(t, 30*time.Second, base.timeout)
+	assert.Equal(t, 0, base.retries)
+	assert.Equal(t, []string{"A=1"}, base.env)
+	assert.Empty(t, base.dir)
+
+	// appending to siblings must not share the backing array
+	first, second := base.Env("C=3"), base.Env("D=4")
+	assert.Equal(t, []string{"A=1", "C=3"}, first.env)
+	assert.Equal(t, []string{"A=1", "D=4"}, second.env)
+
+	clone := base.Clone()
+	assert.Equal(t, base.env, clone.env)
+	assert.NotSame(t, base, clone)
+}
+
+func TestBuilder_ConcurrentDerivedConfigurations(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	base := New(context.Background()).Env("SHARED=base").Timeout(5 * time.Second)
+
+	const n = 20
+	var wg sync.WaitGroup
+	outputs := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			proc := base.
+				Env(fmt.Sprintf("OWN=%d", i)).
+				Timeout(time.Duration(i+1)*time.Second).
+				Retry(i%3, time.Millisecond)
+			assert.Equal(t, time.Duration(i+1)*time.Second, proc.timeout)
+			outputs[i], errs[i] = proc.Execute("sh", "-c", `echo "$SHARED $OWN"`)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, fmt.Sprintf("base %d\n", i), outputs[i])
+	}
+	assert.Equal(t, 5*time.Second, base.timeout)
+	assert.Equal(t, []string{"SHARED=base"}, base.env)
+}
+
+func TestEnvAndDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	output, err := New(context.Background()).
+		Env("SYSCMD_TEST=value").
+		Dir(dir).
+		Execute("sh", "-c", "echo $SYSCMD_TEST; pwd")
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "value")
+	assert.Contains(t, output, dir)
+}
+
 func TestExecute_Success(t *testing.T) {
 	ctx := context.Background()
 	cmd := New(ctx)
@@ -63,6 +135,24 @@ func TestExecute_Success(t *testing.T) {
 	assert.Contains(t, output, "hello")
 }
 
+func TestExecuteResult(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	res, err := New(context.Background()).ExecuteResult("sh", "-c", "echo out; exit 2")
+	require.Error(t, err)
+	require.NotNil(t, res)
+	assert.Equal(t, "out\n", res.Output)
+	assert.Equal(t, 2, res.ExitCode)
+	assert.Equal(t, 1, res.Attempts)
+	assert.Greater(t, res.Duration, time.Duration(0))
+
+	res, err = New(context.Background()).ExecuteResult("this-command-should-not-exist-12345")
+	require.Error(t, err)
+	assert.Equal(t, -1, res.ExitCode)
+}
+
 func TestExecute_Timeout(t *testing.T) {
 	ctx := context.Background()
 	cmd := New(ctx).Timeout(100 * time.Millisecond)
@@ -0,0 +1,345 @@
+package syscmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RotateOpts configures the rotation of a TeeToFile log
+type RotateOpts struct {
+	// MaxSize rotates the file once it would grow beyond this many bytes. Zero disables size rotation.
+	MaxSize int64
+
+	// MaxAge rotates the file once its first line is this old. Zero disables age rotation.
+	MaxAge time.Duration
+
+	// MaxBackups is the number of rotated files kept as path.1 ... path.N. Defaults to 1.
+	MaxBackups int
+
+	// Compress gzips rotated files, naming them path.1.gz ... path.N.gz
+	Compress bool
+}
+
+// TeeToFile appends the output of every execution to the file at path while
+// it is captured. Each line is prefixed with a timestamp, an execution number
+// and the stream it was written to, stdout or stderr; the start and end of
+// the execution and of every attempt are marked with lines tagged "---".
+// To tag them, stdout and stderr are read through separate pipes: each stream
+// keeps its order, but Result.Output and the log interleave them in the order
+// they were read, which can differ from the order the command wrote them and
+// between runs.
+// Lines longer than 32 KiB, such as progress bars redrawn with carriage
+// returns, are split. The file is rotated on line boundaries according to
+// opts and its path is reported in Result.LogFile. Output transformations
+// such as StripANSI apply to the file as well.
+//
+// Failing to open the file fails the execution before the command runs.
+// Later write or rotation failures do not affect the command, they are
+// reported in Result.LogErr. Copies of the Process share the file; other
+// Processes must not write to the same path. Combine with MaxOutput to bound
+// the output kept in memory.
+func (c *Process) TeeToFile(path string, opts RotateOpts) *Process {
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = 1
+	}
+	c = c.Clone()
+	c.tee = &teeLog{path: path, opts: opts}
+	return c
+}
+
+// maxTeeLine is the length at which lines are split in the log
+const maxTeeLine = 32 << 10
+
+// teeLog is the file shared by the executions of a Process using TeeToFile.
+// The file is open while at least one execution is running.
+type teeLog struct {
+	path string
+	opts RotateOpts
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time  // first line of the current file, kept when it is reopened
+	gzipped chan error // result of compressing the last rotated file, nil when none is pending
+	refs    int
+	nextID  int64
+}
+
+// teeExecution writes the lines of one execution to the log and keeps the
+// first failure
+type teeExecution struct {
+	log *teeLog
+	id  int64
+
+	mu  sync.Mutex
+	err error
+}
+
+// begin opens the log when needed and marks the start of an execution
+func (t *teeLog) begin(res *Result) (*teeExecution, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		if err := t.open(); err != nil {
+			return nil, err
+		}
+	}
+	t.refs++
+	t.nextID++
+	x := &teeExecution{log: t, id: t.nextID}
+	argv := RedactArgs(append([]string{res.Name}, res.Args...))
+	x.fail(t.writeLine(x.id, "---", "exec "+Quote(argv...)))
+	return x, nil
+}
+
+// finish marks the end of the execution, closes the log when it was the
+// last one running and returns the first failure of the execution
+func (x *teeExecution) finish(res *Result, err error) error {
+	status := "succeeded"
+	if err != nil {
+		status = "failed"
+	}
+	x.mark("%s with exit code %d after %d attempt(s) in %s", status, res.ExitCode, res.Attempts, res.Duration.Round(time.Millisecond))
+
+	t := x.log
+	t.mu.Lock()
+	t.refs--
+	if t.refs == 0 {
+		x.fail(t.waitCompress())
+		if t.file != nil {
+			x.fail(t.file.Close())
+			t.file = nil
+		}
+	}
+	t.mu.Unlock()
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.err
+}
+
+// mark writes a marker line
+func (x *teeExecution) mark(format string, args ...any) {
+	x.writeLine("---", fmt.Sprintf(format, args...))
+}
+
+// stream returns a writer tagging the lines of a stream. Close writes a last
+// line without line ending.
+func (x *teeExecution) stream(tag string) *teeStream {
+	return &teeStream{x: x, tag: tag}
+}
+
+// writeLine writes a line unless a write failed before
+func (x *teeExecution) writeLine(tag, text string) {
+	if x.failed() {
+		return
+	}
+	x.log.mu.Lock()
+	err := x.log.writeLine(x.id, tag, text)
+	x.log.mu.Unlock()
+	x.fail(err)
+}
+
+func (x *teeExecution) fail(err error) {
+	if err == nil {
+		return
+	}
+	x.mu.Lock()
+	if x.err == nil {
+		x.err = err
+	}
+	x.mu.Unlock()
+}
+
+func (x *teeExecution) failed() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.err != nil
+}
+
+// writeLine writes a line, rotating the file first when needed. t.mu must be held.
+func (t *teeLog) writeLine(id int64, tag, text string) error {
+	if t.file == nil {
+		// a failed rotation could not reopen the file
+		if err := t.open(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	line := fmt.Sprintf("%s [%d] %s %s\n", now.UTC().Format(teeTimeLayout), id, tag, text)
+
+	rotateSize := t.opts.MaxSize > 0 && t.size > 0 && t.size+int64(len(line)) > t.opts.MaxSize
+	rotateAge := t.opts.MaxAge > 0 && t.size > 0 && now.Sub(t.started) >= t.opts.MaxAge
+	if rotateSize || rotateAge {
+		if err := t.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if t.size == 0 {
+		t.started = now
+	}
+	n, err := io.WriteString(t.file, line)
+	t.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write output log: %w", err)
+	}
+	return nil
+}
+
+// teeTimeLayout formats the timestamps starting the lines
+const teeTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+func (t *teeLog) open() error {
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open output log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open output log: %w", err)
+	}
+	t.file = f
+	t.size = info.Size()
+	if t.size > 0 && t.started.IsZero() {
+		t.started = firstLineTime(f, info)
+	}
+	return nil
+}
+
+// firstLineTime returns the time of the first line of an existing log, when
+// it was started before this process opened it, or its modification time
+func firstLineTime(f *os.File, info os.FileInfo) time.Time {
+	buf := make([]byte, len(teeTimeLayout))
+	if _, err := f.ReadAt(buf, 0); err == nil {
+		if started, err := time.Parse(teeTimeLayout, string(buf)); err == nil {
+			return started
+		}
+	}
+	return info.ModTime()
+}
+
+// rotate shifts path.N-1 to path.N, ..., path to path.1, compressing it when
+// configured, and reopens path
+func (t *teeLog) rotate() error {
+	err := t.file.Close()
+	t.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to rotate output log: %w", err)
+	}
+	// the previous rotated file must be compressed before it is shifted
+	if err := t.waitCompress(); err != nil {
+		return err
+	}
+	ext := ""
+	if t.opts.Compress {
+		ext = ".gz"
+	}
+	for i := t.opts.MaxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d%s", t.path, i, ext), fmt.Sprintf("%s.%d%s", t.path, i+1, ext))
+	}
+	if err := os.Rename(t.path, t.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate output log: %w", err)
+	}
+	t.started = time.Time{}
+	if err := t.open(); err != nil {
+		return err
+	}
+	if t.opts.Compress {
+		// compress in the background, the command is blocked on its output
+		// while t.mu is held
+		gzipped := make(chan error, 1)
+		go func(path string) { gzipped <- gzipFile(path) }(t.path + ".1")
+		t.gzipped = gzipped
+	}
+	return nil
+}
+
+// waitCompress waits until the last rotated file is compressed. t.mu must be held.
+func (t *teeLog) waitCompress() error {
+	if t.gzipped == nil {
+		return nil
+	}
+	err := <-t.gzipped
+	t.gzipped = nil
+	if err != nil {
+		return fmt.Errorf("failed to compress rotated output log: %w", err)
+	}
+	return nil
+}
+
+// gzipFile replaces path with path.gz
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// teeStream splits a stream into lines written to the log. Lines longer
+// than maxTeeLine are split. Failures are kept by the execution and do not
+// interrupt the command.
+type teeStream struct {
+	x       *teeExecution
+	tag     string
+	partial []byte
+}
+
+func (s *teeStream) Write(p []byte) (int, error) {
+	s.partial = append(s.partial, p...)
+	line := s.partial
+	for {
+		i := bytes.IndexByte(line, '\n')
+		if i < 0 {
+			break
+		}
+		s.x.writeLine(s.tag, string(bytes.TrimSuffix(line[:i], []byte("\r"))))
+		line = line[i+1:]
+	}
+	for len(line) > maxTeeLine {
+		cut := maxTeeLine
+		for cut > maxTeeLine-utf8.UTFMax && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		s.x.writeLine(s.tag, string(line[:cut]))
+		line = line[cut:]
+	}
+	s.partial = s.partial[:copy(s.partial, line)]
+	return len(p), nil
+}
+
+func (s *teeStream) Close() error {
+	if len(s.partial) > 0 {
+		s.x.writeLine(s.tag, string(s.partial))
+		s.partial = nil
+	}
+	return nil
+}
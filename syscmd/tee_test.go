@@ -0,0 +1,243 @@
+package syscmd
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readLines returns the lines of a log file with their timestamps removed
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		r = zr
+	}
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	timestamp := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z `)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		require.Regexp(t, timestamp, line)
+		lines = append(lines, timestamp.ReplaceAllString(line, ""))
+	}
+	return lines
+}
+
+func TestTeeToFile_TagsStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	proc := New(context.Background()).TeeToFile(path, RotateOpts{})
+
+	res, err := proc.ExecuteResult("sh", "-c", "echo out; echo err >&2; printf partial")
+	require.NoError(t, err)
+	assert.Equal(t, path, res.LogFile)
+	assert.Contains(t, res.Output, "out\n")
+	assert.Contains(t, res.Output, "err\n")
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 7)
+	assert.Equal(t, `[1] --- exec sh -c 'echo out; echo err >&2; printf partial'`, lines[0])
+	assert.Equal(t, "[1] --- attempt 1", lines[1])
+	assert.ElementsMatch(t, []string{"[1] stdout out", "[1] stderr err", "[1] stdout partial"}, lines[2:5])
+	assert.Regexp(t, `^\[1\] --- attempt 1 exited with code 0 in `, lines[5])
+	assert.Regexp(t, `^\[1\] --- succeeded with exit code 0 after 1 attempt\(s\) in `, lines[6])
+
+	// executions append to the file with their own number
+	_, err = proc.Execute("echo", "again")
+	require.NoError(t, err)
+	lines = readLines(t, path)
+	require.Len(t, lines, 12)
+	assert.Equal(t, "[2] --- exec echo again", lines[7])
+	assert.Equal(t, "[2] stdout again", lines[9])
+}
+
+func TestTeeToFile_AttemptMarkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	_, err := New(context.Background()).
+		TeeToFile(path, RotateOpts{}).
+		Retry(1, 10*time.Millisecond).
+		Execute("sh", "-c", "echo try; exit 3")
+	require.Error(t, err)
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 8)
+	assert.Equal(t, "[1] --- attempt 1", lines[1])
+	assert.Equal(t, "[1] stdout try", lines[2])
+	assert.Regexp(t, `^\[1\] --- attempt 1 exited with code 3 in `, lines[3])
+	assert.Equal(t, "[1] --- attempt 2", lines[4])
+	assert.Regexp(t, `^\[1\] --- failed with exit code 3 after 2 attempt\(s\) in `, lines[7])
+}
+
+func TestTeeToFile_RedactsCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	_, err := New(context.Background()).TeeToFile(path, RotateOpts{}).Execute("echo", "--password=hunter2")
+	require.NoError(t, err)
+
+	lines := readLines(t, path)
+	assert.NotContains(t, lines[0], "hunter2")
+}
+
+func TestTeeToFile_SizeRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	proc := New(context.Background()).TeeToFile(path, RotateOpts{MaxSize: 200, MaxBackups: 2, Compress: true})
+
+	for i := 0; i < 3; i++ {
+		_, err := proc.Execute("echo", "line")
+		require.NoError(t, err)
+	}
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(200))
+	assert.NoFileExists(t, path+".1")
+	assert.FileExists(t, path+".2.gz")
+	assert.NoFileExists(t, path+".3.gz")
+
+	// every line is kept whole in exactly one file
+	lines := append(readLines(t, path+".2.gz"), readLines(t, path+".1.gz")...)
+	lines = append(lines, readLines(t, path)...)
+	assert.Contains(t, lines, "[3] stdout line")
+	assert.Equal(t, "[3] --- attempt 1", lines[len(lines)-4])
+}
+
+func TestTeeToFile_CompressesWhileWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	_, err := New(context.Background()).
+		TeeToFile(path, RotateOpts{MaxSize: 1000, MaxBackups: 3, Compress: true}).
+		Execute("seq", "200")
+	require.NoError(t, err)
+
+	// rotations within one execution keep every backup whole and in order
+	assert.NoFileExists(t, path+".1")
+	var lines []string
+	for _, name := range []string{path + ".3.gz", path + ".2.gz", path + ".1.gz", path} {
+		lines = append(lines, readLines(t, name)...)
+	}
+	var numbers []string
+	for _, line := range lines {
+		if n, ok := strings.CutPrefix(line, "[1] stdout "); ok {
+			numbers = append(numbers, n)
+		}
+	}
+	require.NotEmpty(t, numbers)
+	last := 200
+	for i := len(numbers) - 1; i >= 0; i-- {
+		assert.Equal(t, strconv.Itoa(last), numbers[i])
+		last--
+	}
+}
+
+func TestTeeToFile_AgeRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	_, err := New(context.Background()).
+		TeeToFile(path, RotateOpts{MaxAge: 50 * time.Millisecond}).
+		Execute("sh", "-c", "echo before; sleep 0.1; echo after")
+	require.NoError(t, err)
+
+	rotated := readLines(t, path+".1")
+	assert.Contains(t, rotated, "[1] stdout before")
+	current := readLines(t, path)
+	assert.Equal(t, "[1] stdout after", current[0])
+}
+
+func TestTeeToFile_AgeRotationAcrossExecutions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	proc := New(context.Background()).TeeToFile(path, RotateOpts{MaxAge: 100 * time.Millisecond})
+
+	// each execution reopens the log, the age still counts from its first line
+	for i := 0; i < 3; i++ {
+		_, err := proc.Execute("echo", "line")
+		require.NoError(t, err)
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	assert.Equal(t, "[1] --- exec echo line", readLines(t, path+".1")[0])
+	assert.Equal(t, "[3] --- exec echo line", readLines(t, path)[0])
+}
+
+func TestTeeToFile_WriteErrorKeepsResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	// a directory in the way of the rotated file makes rotation fail
+	require.NoError(t, os.Mkdir(path+".1", 0o700))
+
+	res, err := New(context.Background()).
+		TeeToFile(path, RotateOpts{MaxSize: 100}).
+		Retry(2, time.Millisecond).
+		ExecuteResult("sh", "-c", "echo first line; echo second line")
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Equal(t, 1, res.Attempts)
+	assert.Equal(t, "first line\nsecond line\n", res.Output)
+	assert.ErrorContains(t, res.LogErr, "failed to rotate output log")
+}
+
+func TestTeeToFile_SplitsLongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	_, err := New(context.Background()).
+		TeeToFile(path, RotateOpts{}).
+		Execute("sh", "-c", "head -c 70000 /dev/zero | tr '\\0' x")
+	require.NoError(t, err)
+
+	lines := readLines(t, path)
+	require.Len(t, lines, 7)
+	assert.Equal(t, "[1] stdout "+strings.Repeat("x", maxTeeLine), lines[2])
+	assert.Equal(t, "[1] stdout "+strings.Repeat("x", maxTeeLine), lines[3])
+	assert.Equal(t, "[1] stdout "+strings.Repeat("x", 70000-2*maxTeeLine), lines[4])
+}
+
+func TestTeeToFile_OpenError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "out.log")
+	res, err := New(context.Background()).TeeToFile(path, RotateOpts{}).ExecuteResult("echo", "hello")
+	require.ErrorContains(t, err, "failed to open output log")
+	assert.Equal(t, 0, res.Attempts)
+	assert.Empty(t, res.LogFile)
+}
+
+func TestTeeToFile_DryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	res, err := New(context.Background()).DryRun(&DryRunRecorder{}).TeeToFile(path, RotateOpts{}).ExecuteResult("echo", "hello")
+	require.NoError(t, err)
+	assert.Empty(t, res.LogFile)
+	assert.NoFileExists(t, path)
+}
+
+func TestMaxOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	res, err := New(context.Background()).
+		MaxOutput(10).
+		TeeToFile(path, RotateOpts{}).
+		ExecuteResult("sh", "-c", "seq 1 1000")
+	require.NoError(t, err)
+	assert.Equal(t, "\n999\n1000\n", res.Output)
+
+	// the log still has all of it
+	lines := readLines(t, path)
+	assert.Equal(t, "[1] stdout 1", lines[2])
+	assert.Equal(t, "[1] stdout 1000", lines[1001])
+}
+
+func TestCaptureBuffer_RuneBoundary(t *testing.T) {
+	b := &captureBuffer{max: 4}
+	for _, s := range []string{"aaaa", "ééé"} {
+		_, err := b.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "éé", string(b.Bytes()))
+}
@@ -0,0 +1 @@
+echo "$0: hello $1"
@@ -0,0 +1,188 @@
+// Package tracing instruments syscmd executions with OpenTelemetry spans.
+//
+// Every execution gets a span with a child span per attempt and per backoff
+// wait between attempts. The trace context of the attempt is passed to the
+// command in the TRACEPARENT environment variable, so instrumented children
+// continue the trace.
+//
+//	t := tracing.New(tracing.Options{})
+//	output, err := t.Instrument(syscmd.New(ctx)).Execute("git", "fetch")
+package tracing
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"gtihub.com/sowinskl/go-common/syscmd"
+)
+
+// ScopeName is the instrumentation scope of the tracer
+const ScopeName = "gtihub.com/sowinskl/go-common/syscmd/tracing"
+
+// Span attributes
+const (
+	AttrBinary     = attribute.Key("process.executable.name")
+	AttrArgs       = attribute.Key("process.command_args")
+	AttrExitCode   = attribute.Key("process.exit.code")
+	AttrAttempt    = attribute.Key("syscmd.attempt")
+	AttrAttempts   = attribute.Key("syscmd.attempts")
+	AttrDurationMS = attribute.Key("syscmd.duration_ms")
+	AttrDelayMS    = attribute.Key("syscmd.backoff.delay_ms")
+)
+
+// Options configures a Tracer
+type Options struct {
+	// TracerProvider creates the tracer. Defaults to the global provider.
+	TracerProvider trace.TracerProvider
+
+	// Propagator writes the trace context passed to the command. Defaults to
+	// W3C trace context, setting TRACEPARENT and TRACESTATE.
+	Propagator propagation.TextMapPropagator
+
+	// MaxArgsLength truncates the recorded arguments. Defaults to 256 bytes.
+	MaxArgsLength int
+}
+
+// Tracer creates the spans of the executions of the processes it instruments
+type Tracer struct {
+	tracer        trace.Tracer
+	propagator    propagation.TextMapPropagator
+	maxArgsLength int
+}
+
+// New creates a Tracer
+func New(opts Options) *Tracer {
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+	if opts.Propagator == nil {
+		opts.Propagator = propagation.TraceContext{}
+	}
+	if opts.MaxArgsLength <= 0 {
+		opts.MaxArgsLength = 256
+	}
+	return &Tracer{
+		tracer:        opts.TracerProvider.Tracer(ScopeName),
+		propagator:    opts.Propagator,
+		maxArgsLength: opts.MaxArgsLength,
+	}
+}
+
+// Instrument adds the hooks of the tracer to p
+func (t *Tracer) Instrument(p *syscmd.Process) *syscmd.Process {
+	return p.Hooks(t.Hooks())
+}
+
+type stateKey struct{}
+
+// state carries the spans of an execution between hooks
+type state struct {
+	execution trace.Span
+	backoff   trace.Span
+}
+
+func (s *state) endBackoff() {
+	if s.backoff != nil {
+		s.backoff.End()
+		s.backoff = nil
+	}
+}
+
+func stateFrom(ctx context.Context) *state {
+	s, _ := ctx.Value(stateKey{}).(*state)
+	return s
+}
+
+// Hooks returns the hooks creating the spans, see syscmd.Process.Hooks
+func (t *Tracer) Hooks() syscmd.Hooks {
+	return syscmd.Hooks{
+		OnStart: func(ctx context.Context, e *syscmd.Execution) context.Context {
+			binary := filepath.Base(e.Name)
+			ctx, span := t.tracer.Start(ctx, "exec "+binary,
+				trace.WithTimestamp(e.Start),
+				trace.WithAttributes(AttrBinary.String(binary), AttrArgs.String(t.args(e.Args))))
+			return context.WithValue(ctx, stateKey{}, &state{execution: span})
+		},
+		OnAttempt: func(ctx context.Context, e *syscmd.Execution, a *syscmd.Attempt) context.Context {
+			if s := stateFrom(ctx); s != nil {
+				s.endBackoff()
+			}
+			ctx, _ = t.tracer.Start(ctx, "attempt",
+				trace.WithTimestamp(a.Start),
+				trace.WithAttributes(AttrAttempt.Int(a.Number)))
+
+			carrier := propagation.MapCarrier{}
+			t.propagator.Inject(ctx, carrier)
+			for key, value := range carrier {
+				a.Env = append(a.Env, envName(key)+"="+value)
+			}
+			return ctx
+		},
+		OnAttemptDone: func(ctx context.Context, e *syscmd.Execution, a *syscmd.Attempt, res *syscmd.Result, err error) {
+			span := trace.SpanFromContext(ctx)
+			span.SetAttributes(AttrExitCode.Int(res.ExitCode))
+			setError(span, err)
+			span.End()
+		},
+		OnRetry: func(ctx context.Context, e *syscmd.Execution, err error, delay time.Duration) {
+			s := stateFrom(ctx)
+			if s == nil {
+				return
+			}
+			s.endBackoff()
+			_, s.backoff = t.tracer.Start(ctx, "backoff", trace.WithAttributes(AttrDelayMS.Int64(delay.Milliseconds())))
+		},
+		OnFinish: func(ctx context.Context, e *syscmd.Execution, res *syscmd.Result, err error) {
+			s := stateFrom(ctx)
+			if s == nil {
+				return
+			}
+			s.endBackoff()
+			s.execution.SetAttributes(
+				AttrExitCode.Int(res.ExitCode),
+				AttrAttempts.Int(res.Attempts),
+				AttrDurationMS.Int64(res.Duration.Milliseconds()),
+			)
+			setError(s.execution, err)
+			s.execution.End()
+		},
+	}
+}
+
+// args renders the redacted arguments, truncated to the configured length
+func (t *Tracer) args(args []string) string {
+	line := strings.Join(syscmd.RedactArgs(args), " ")
+	if len(line) > t.maxArgsLength {
+		n := t.maxArgsLength
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+		line = line[:n] + "..."
+	}
+	return line
+}
+
+// setError marks the span as failed. Only the ErrorSummary is recorded, the
+// error itself carries the command output.
+func setError(span trace.Span, err error) {
+	if err != nil {
+		summary := syscmd.ErrorSummary(err)
+		span.RecordError(errors.New(summary))
+		span.SetStatus(codes.Error, summary)
+	}
+}
+
+// envName turns a propagation header into an environment variable name,
+// traceparent becomes TRACEPARENT
+func envName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
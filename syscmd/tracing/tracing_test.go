@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gtihub.com/sowinskl/go-common/syscmd"
+)
+
+func newTracer(t *testing.T, opts Options) (*Tracer, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	opts.TracerProvider = provider
+	return New(opts), exporter, provider
+}
+
+func spansByName(spans tracetest.SpanStubs) map[string][]tracetest.SpanStub {
+	byName := make(map[string][]tracetest.SpanStub)
+	for _, s := range spans {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	return byName
+}
+
+func attr(s tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracer_Spans(t *testing.T) {
+	tracer, exporter, provider := newTracer(t, Options{})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	output, err := tracer.Instrument(syscmd.New(ctx)).Execute("sh", "-c", `echo "$TRACEPARENT"`, "--password=hunter2")
+	parent.End()
+	require.NoError(t, err)
+
+	spans := spansByName(exporter.GetSpans())
+	require.Len(t, spans["exec sh"], 1)
+	require.Len(t, spans["attempt"], 1)
+	exec, attempt := spans["exec sh"][0], spans["attempt"][0]
+
+	assert.Equal(t, parent.SpanContext().SpanID(), exec.Parent.SpanID())
+	assert.Equal(t, exec.SpanContext.SpanID(), attempt.Parent.SpanID())
+	assert.Equal(t, "sh", attr(exec, AttrBinary).AsString())
+	assert.Equal(t, int64(0), attr(exec, AttrExitCode).AsInt64())
+	assert.Equal(t, int64(1), attr(exec, AttrAttempts).AsInt64())
+	assert.Contains(t, attr(exec, AttrArgs).AsString(), "--password="+syscmd.Redacted)
+	assert.NotContains(t, attr(exec, AttrArgs).AsString(), "hunter2")
+
+	// the command continues the trace under the attempt span
+	expected := "00-" + attempt.SpanContext.TraceID().String() + "-" + attempt.SpanContext.SpanID().String() + "-01"
+	assert.Equal(t, expected+"\n", output)
+}
+
+func TestTracer_RetriesAndBackoff(t *testing.T) {
+	tracer, exporter, _ := newTracer(t, Options{})
+
+	_, err := tracer.Instrument(syscmd.New(context.Background())).Retry(2, 10*time.Millisecond).Execute("false")
+	require.Error(t, err)
+
+	spans := spansByName(exporter.GetSpans())
+	require.Len(t, spans["exec false"], 1)
+	require.Len(t, spans["attempt"], 3)
+	require.Len(t, spans["backoff"], 2)
+
+	exec := spans["exec false"][0]
+	assert.Equal(t, codes.Error, exec.Status.Code)
+	assert.Equal(t, int64(3), attr(exec, AttrAttempts).AsInt64())
+	assert.Equal(t, int64(1), attr(exec, AttrExitCode).AsInt64())
+	for i, a := range spans["attempt"] {
+		assert.Equal(t, exec.SpanContext.SpanID(), a.Parent.SpanID())
+		assert.Equal(t, int64(i+1), attr(a, AttrAttempt).AsInt64())
+		assert.Equal(t, codes.Error, a.Status.Code)
+	}
+	for _, b := range spans["backoff"] {
+		assert.Equal(t, exec.SpanContext.SpanID(), b.Parent.SpanID())
+		assert.Greater(t, attr(b, AttrDelayMS).AsInt64(), int64(0))
+	}
+}
+
+func TestTracer_OmitsOutput(t *testing.T) {
+	tracer, exporter, _ := newTracer(t, Options{})
+
+	_, err := tracer.Instrument(syscmd.New(context.Background())).
+		Env("OUT=SECRET_OUTPUT").
+		Execute("sh", "-c", "echo $OUT; exit 4")
+	require.Error(t, err)
+
+	for _, span := range exporter.GetSpans() {
+		assert.NotContains(t, span.Status.Description, "SECRET_OUTPUT", span.Name)
+		for _, event := range span.Events {
+			for _, kv := range event.Attributes {
+				assert.NotContains(t, kv.Value.Emit(), "SECRET_OUTPUT", span.Name)
+			}
+		}
+	}
+	exec := spansByName(exporter.GetSpans())["exec sh"][0]
+	assert.Equal(t, "command failed: exit status 4", exec.Status.Description)
+}
+
+func TestTracer_TruncatesArgs(t *testing.T) {
+	tracer, _, _ := newTracer(t, Options{MaxArgsLength: 10})
+	assert.Equal(t, "aaaa bbbbb...", tracer.args([]string{"aaaa", strings.Repeat("b", 20)}))
+	assert.Equal(t, "é", tracer.args([]string{"é"}))
+	assert.Equal(t, "aaaaaaaaa...", tracer.args([]string{"aaaaaaaaaé"}))
+}
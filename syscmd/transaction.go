@@ -0,0 +1,171 @@
+package syscmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Action is a command run by a transaction step
+type Action struct {
+	Process *Process
+	Command string
+	Args    []string
+}
+
+func (a Action) run(ctx context.Context) error {
+	if a.Process == nil {
+		return errors.New("action has no process")
+	}
+	proc, cancel := a.Process.under(ctx)
+	defer cancel()
+	_, err := proc.ExecuteResult(a.Command, a.Args...)
+	return err
+}
+
+// Step is a change made by a transaction together with the command undoing it
+type Step struct {
+	Name string
+	Do   Action
+
+	// Undo reverts Do. It runs with the timeout and retry settings of its own
+	// Process, under the process context without its cancellation, so it still
+	// runs after the transaction or process context was canceled. Values of
+	// the process context such as dry-run mode apply to it. Nil means there is
+	// nothing to undo.
+	Undo *Action
+
+	// UndoTimeout bounds Undo including its retries. Defaults to one minute.
+	UndoTimeout time.Duration
+}
+
+// undo runs Undo detached from the cancellation of its process context
+func (s Step) undo() error {
+	if s.Undo.Process == nil {
+		return errors.New("action has no process")
+	}
+	timeout := s.UndoTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(s.Undo.Process.ctx), timeout)
+	defer cancel()
+
+	proc := s.Undo.Process.Clone()
+	proc.ctx = ctx
+	_, err := proc.ExecuteResult(s.Undo.Command, s.Undo.Args...)
+	return err
+}
+
+// TransactionError reports a failed step together with any failures of the rollback
+type TransactionError struct {
+	Step         string  // the step that failed, empty when the context ended between steps
+	Err          error   // the original failure
+	RollbackErrs []error // failures of undo commands, in the order they ran
+}
+
+func (e *TransactionError) Error() string {
+	var b strings.Builder
+	if e.Step != "" {
+		fmt.Fprintf(&b, "step %q failed: %v", e.Step, e.Err)
+	} else {
+		fmt.Fprintf(&b, "transaction aborted: %v", e.Err)
+	}
+	if len(e.RollbackErrs) > 0 {
+		msgs := make([]string, len(e.RollbackErrs))
+		for i, err := range e.RollbackErrs {
+			msgs[i] = err.Error()
+		}
+		fmt.Fprintf(&b, "; rollback failed: %s", strings.Join(msgs, "; "))
+	}
+	return b.String()
+}
+
+func (e *TransactionError) Unwrap() []error {
+	return append([]error{e.Err}, e.RollbackErrs...)
+}
+
+// Transaction runs steps and undoes the completed ones in reverse order when
+// a later step fails. It is safe for concurrent use, but steps are recorded
+// in the order they complete.
+//
+//	tx := syscmd.NewTransaction()
+//	defer tx.Rollback() // no-op after Commit
+//	if err := tx.Do(ctx, step1); err != nil {
+//		return err
+//	}
+//	...
+//	tx.Commit()
+type Transaction struct {
+	mu   sync.Mutex
+	done []Step
+}
+
+// NewTransaction creates an empty transaction
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// Do runs the step and records it for rollback when it succeeds
+func (t *Transaction) Do(ctx context.Context, step Step) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := step.Do.run(ctx); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.done = append(t.done, step)
+	t.mu.Unlock()
+	return nil
+}
+
+// Commit forgets the completed steps so that Rollback does nothing
+func (t *Transaction) Commit() {
+	t.mu.Lock()
+	t.done = nil
+	t.mu.Unlock()
+}
+
+// Rollback undoes the completed steps in reverse order. Every undo command
+// is attempted even when an earlier one fails; the failures are joined.
+func (t *Transaction) Rollback() error {
+	return errors.Join(t.rollback()...)
+}
+
+func (t *Transaction) rollback() []error {
+	t.mu.Lock()
+	done := t.done
+	t.done = nil
+	t.mu.Unlock()
+
+	var errs []error
+	for i := len(done) - 1; i >= 0; i-- {
+		if done[i].Undo == nil {
+			continue
+		}
+		if err := done[i].undo(); err != nil {
+			errs = append(errs, fmt.Errorf("undo %q: %w", done[i].Name, err))
+		}
+	}
+	return errs
+}
+
+// RunTransaction runs the steps in order. When a step fails or ctx ends, the
+// completed steps are undone in reverse order and a *TransactionError is returned.
+func RunTransaction(ctx context.Context, steps ...Step) error {
+	tx := NewTransaction()
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return &TransactionError{Err: err, RollbackErrs: tx.rollback()}
+		}
+		if err := tx.Do(ctx, step); err != nil {
+			return &TransactionError{Step: step.Name, Err: err, RollbackErrs: tx.rollback()}
+		}
+	}
+	return nil
+}
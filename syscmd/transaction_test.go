@@ -0,0 +1,194 @@
+package syscmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// journalStep appends "do <name>" and "undo <name>" lines to a journal file
+func journalStep(journal, name string, fail bool) Step {
+	proc := New(context.Background())
+	script := "echo do " + name + " >> " + journal
+	if fail {
+		script += "; exit 1"
+	}
+	return Step{
+		Name: name,
+		Do:   Action{Process: proc, Command: "sh", Args: []string{"-c", script}},
+		Undo: &Action{Process: proc, Command: "sh", Args: []string{"-c", "echo undo " + name + " >> " + journal}},
+	}
+}
+
+func readJournal(t *testing.T, journal string) []string {
+	t.Helper()
+	data, err := os.ReadFile(journal)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestRunTransaction_Success(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal")
+	err := RunTransaction(context.Background(),
+		journalStep(journal, "one", false),
+		journalStep(journal, "two", false),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"do one", "do two"}, readJournal(t, journal))
+}
+
+func TestRunTransaction_RollsBackInReverse(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal")
+	err := RunTransaction(context.Background(),
+		journalStep(journal, "one", false),
+		journalStep(journal, "two", false),
+		journalStep(journal, "three", true),
+		journalStep(journal, "four", false),
+	)
+	require.Error(t, err)
+
+	var txErr *TransactionError
+	require.True(t, errors.As(err, &txErr))
+	assert.Equal(t, "three", txErr.Step)
+	assert.Empty(t, txErr.RollbackErrs)
+	assert.Equal(t, []string{"do one", "do two", "do three", "undo two", "undo one"}, readJournal(t, journal))
+}
+
+func TestRunTransaction_ReportsRollbackFailures(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal")
+	broken := journalStep(journal, "two", false)
+	broken.Undo = &Action{Process: New(context.Background()).Retry(1, 10*time.Millisecond), Command: "false"}
+
+	err := RunTransaction(context.Background(),
+		journalStep(journal, "one", false),
+		broken,
+		journalStep(journal, "three", true),
+	)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `step "three" failed`)
+	assert.Contains(t, err.Error(), `rollback failed: undo "two"`)
+	assert.Contains(t, err.Error(), "failed after 1 retries")
+
+	// the remaining undo commands still run
+	assert.Equal(t, []string{"do one", "do two", "do three", "undo one"}, readJournal(t, journal))
+}
+
+func TestRunTransaction_Cancel(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	slow := Step{
+		Name: "slow",
+		Do:   Action{Process: New(context.Background()), Command: "sleep", Args: []string{"5"}},
+	}
+	err := RunTransaction(ctx, journalStep(journal, "one", false), slow)
+	require.Error(t, err)
+
+	// undo runs even though the transaction context is done
+	assert.Equal(t, []string{"do one", "undo one"}, readJournal(t, journal))
+}
+
+func TestRunTransaction_CancelProcessContext(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal")
+	ctx, cancel := context.WithCancel(WithActor(context.Background(), "alice"))
+	proc := New(ctx)
+
+	var buf bytes.Buffer
+	audited := proc.Audit(NewAuditLog(&buf, AuditOptions{}))
+	one := Step{
+		Name: "one",
+		Do:   Action{Process: proc, Command: "sh", Args: []string{"-c", "echo do one >> " + journal}},
+		Undo: &Action{Process: audited, Command: "sh", Args: []string{"-c", "echo undo one >> " + journal}},
+	}
+	slow := Step{Name: "slow", Do: Action{Process: proc, Command: "sleep", Args: []string{"5"}}}
+
+	time.AfterFunc(200*time.Millisecond, cancel)
+	err := RunTransaction(ctx, one, slow)
+	var txErr *TransactionError
+	require.ErrorAs(t, err, &txErr)
+	assert.Empty(t, txErr.RollbackErrs)
+
+	// the undo runs although the context of its process was canceled, and
+	// keeps the values of that context
+	assert.Equal(t, []string{"do one", "undo one"}, readJournal(t, journal))
+	entries := readAuditEntries(t, buf.Bytes())
+	require.Len(t, entries, 1)
+	assert.Equal(t, "alice", entries[0].Actor)
+}
+
+func TestRunTransaction_UndoTimeout(t *testing.T) {
+	ctx := context.Background()
+	step := Step{
+		Name:        "one",
+		Do:          Action{Process: New(ctx), Command: "true"},
+		Undo:        &Action{Process: New(ctx), Command: "sleep", Args: []string{"5"}},
+		UndoTimeout: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	err := RunTransaction(ctx, step, Step{Name: "two", Do: Action{Process: New(ctx), Command: "false"}})
+	var txErr *TransactionError
+	require.ErrorAs(t, err, &txErr)
+	require.Len(t, txErr.RollbackErrs, 1)
+	assert.ErrorIs(t, txErr.RollbackErrs[0], context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestTransaction_Manual(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal")
+	ctx := context.Background()
+
+	tx := NewTransaction()
+	require.NoError(t, tx.Do(ctx, journalStep(journal, "one", false)))
+	require.NoError(t, tx.Do(ctx, Step{Name: "no-undo", Do: Action{Process: New(ctx), Command: "true"}}))
+	require.Error(t, tx.Do(ctx, journalStep(journal, "two", true)))
+	require.NoError(t, tx.Rollback())
+	assert.Equal(t, []string{"do one", "do two", "undo one"}, readJournal(t, journal))
+
+	// nothing is undone after a commit
+	tx = NewTransaction()
+	require.NoError(t, tx.Do(ctx, journalStep(journal, "three", false)))
+	tx.Commit()
+	require.NoError(t, tx.Rollback())
+	assert.Equal(t, "do three", readJournal(t, journal)[3])
+	assert.Len(t, readJournal(t, journal), 4)
+}
+
+func TestRunTransaction_DryRunRollback(t *testing.T) {
+	dir := t.TempDir()
+	rec := &DryRunRecorder{Respond: func(cmd PlannedCommand) (string, int) {
+		if cmd.Name == "false" {
+			return "", 1
+		}
+		return "", 0
+	}}
+	proc := New(WithDryRun(context.Background(), rec))
+	undone := filepath.Join(dir, "undone")
+
+	err := RunTransaction(context.Background(),
+		Step{
+			Name: "one",
+			Do:   Action{Process: proc, Command: "true"},
+			Undo: &Action{Process: proc, Command: "touch", Args: []string{undone}},
+		},
+		Step{Name: "two", Do: Action{Process: proc, Command: "false"}},
+	)
+	var txErr *TransactionError
+	require.ErrorAs(t, err, &txErr)
+	assert.Equal(t, "two", txErr.Step)
+
+	// the undo command is planned, never run
+	assert.NoFileExists(t, undone)
+	commands := rec.Commands()
+	require.Len(t, commands, 3)
+	assert.Equal(t, "touch", commands[2].Name)
+}
@@ -0,0 +1,61 @@
+package syscmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Condition decides whether a polled command reached the expected state
+type Condition func(res *Result, err error) bool
+
+// Succeeds is met when the command exits successfully
+func Succeeds() Condition {
+	return func(_ *Result, err error) bool {
+		return err == nil
+	}
+}
+
+// ExitsWith is met when the command exits with the given code
+func ExitsWith(code int) Condition {
+	return func(res *Result, _ error) bool {
+		return res.ExitCode == code
+	}
+}
+
+// OutputMatches is met when the command succeeds and its output satisfies match
+func OutputMatches(match func(output string) bool) Condition {
+	return func(res *Result, err error) bool {
+		return err == nil && match(res.Output)
+	}
+}
+
+// WaitUntil runs the command repeatedly until cond is met or ctx ends. Each
+// attempt is bounded by the timeout (and retries) of cmd, attempts are
+// separated by interval. It returns the last Result and the Results of all
+// attempts in order.
+func WaitUntil(ctx context.Context, cmd *Process, interval time.Duration, cond Condition, name string, args ...string) (*Result, []*Result, error) {
+	poll, cancel := cmd.under(ctx)
+	defer cancel()
+	ctx = poll.ctx
+
+	var history []*Result
+	for {
+		res, err := poll.ExecuteResult(name, args...)
+		history = append(history, res)
+		if cond(res, err) {
+			return res, history, nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err != nil {
+				return res, history, fmt.Errorf("condition not met after %d attempts: %w (last error: %v)", len(history), ctx.Err(), err)
+			}
+			return res, history, fmt.Errorf("condition not met after %d attempts: %w", len(history), ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
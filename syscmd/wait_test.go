@@ -0,0 +1,95 @@
+package syscmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitUntil_Succeeds(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ready")
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		New(context.Background()).Execute("touch", marker)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, history, err := WaitUntil(ctx, New(context.Background()), 50*time.Millisecond, Succeeds(), "test", "-f", marker)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.ExitCode)
+	assert.Greater(t, len(history), 1)
+	assert.Same(t, res, history[len(history)-1])
+	assert.Equal(t, 1, history[0].ExitCode)
+}
+
+func TestWaitUntil_ExitCode(t *testing.T) {
+	res, history, err := WaitUntil(context.Background(), New(context.Background()), time.Millisecond, ExitsWith(3), "sh", "-c", "exit 3")
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Len(t, history, 1)
+}
+
+func TestWaitUntil_OutputMatches(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	script := "echo x >> " + counter + "; wc -l < " + counter
+
+	cond := OutputMatches(func(output string) bool {
+		return strings.TrimSpace(output) == "3"
+	})
+	_, history, err := WaitUntil(context.Background(), New(context.Background()), time.Millisecond, cond, "sh", "-c", script)
+	require.NoError(t, err)
+	assert.Len(t, history, 3)
+}
+
+func TestWaitUntil_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	res, history, err := WaitUntil(ctx, New(context.Background()), 50*time.Millisecond, Succeeds(), "false")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "last error")
+	assert.NotNil(t, res)
+	assert.NotEmpty(t, history)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWaitUntil_AttemptTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// each attempt is cut short by the process timeout, not by the poll interval
+	cmd := New(context.Background()).Timeout(100 * time.Millisecond)
+	_, history, err := WaitUntil(ctx, cmd, 10*time.Millisecond, Succeeds(), "sleep", "5")
+	require.Error(t, err)
+	assert.Greater(t, len(history), 5)
+	for _, res := range history {
+		assert.Less(t, res.Duration, time.Second)
+	}
+}
+
+func TestWaitUntil_ProcessContext(t *testing.T) {
+	procCtx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	_, _, err := WaitUntil(context.Background(), New(procCtx), 50*time.Millisecond, Succeeds(), "false")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWaitUntil_KeepsProcessContextValues(t *testing.T) {
+	rec := &DryRunRecorder{}
+	marker := filepath.Join(t.TempDir(), "marker")
+	cmd := New(WithDryRun(context.Background(), rec))
+
+	_, _, err := WaitUntil(context.Background(), cmd, time.Millisecond, Succeeds(), "touch", marker)
+	require.NoError(t, err)
+	assert.NoFileExists(t, marker)
+	assert.Len(t, rec.Commands(), 1)
+}